@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/gokul656/obscure-fs/internal/auth"
+	"github.com/gokul656/obscure-fs/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	apiKeyName   string
+	apiKeyScopes []string
+	apiKeyQuota  string
+)
+
+var apiKeyCmd = &cobra.Command{
+	Use:   "apikey",
+	Short: "Manage API keys for the REST API",
+}
+
+var apiKeyCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create an API key, the secret is printed once",
+	Run: func(cmd *cobra.Command, args []string) {
+		scopes, err := auth.ParseScopes(apiKeyScopes)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		quota, err := utils.ParseSize(apiKeyQuota)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		keys := loadKeyStore()
+		secret, key, err := keys.Create(apiKeyName, scopes)
+		if err != nil {
+			log.Fatalf("Failed to create API key: %v\n", err)
+		}
+		if quota > 0 {
+			if err := keys.SetQuota(key.ID, quota); err != nil {
+				log.Fatalf("Failed to set quota: %v\n", err)
+			}
+		}
+
+		fmt.Printf("id:     %s\n", key.ID)
+		fmt.Printf("scopes: %v\n", key.Scopes)
+		fmt.Printf("key:    %s\n", secret)
+	},
+}
+
+var apiKeyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List API keys",
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, key := range loadKeyStore().List() {
+			scopes := make([]string, len(key.Scopes))
+			for i, s := range key.Scopes {
+				scopes[i] = string(s)
+			}
+			quota := "default"
+			if key.Quota > 0 {
+				quota = fmt.Sprintf("%d", key.Quota)
+			}
+			fmt.Printf("%s\t%s\t%s\t%s\t%s\n", key.ID, key.Name, strings.Join(scopes, ","), quota, key.CreatedAt.Format("2006-01-02 15:04"))
+		}
+	},
+}
+
+var apiKeyRevokeCmd = &cobra.Command{
+	Use:   "revoke <id>",
+	Short: "Revoke an API key",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := loadKeyStore().Revoke(args[0]); err != nil {
+			log.Fatalln(err)
+		}
+		fmt.Printf("revoked: %s\n", args[0])
+	},
+}
+
+var apiKeyQuotaCmd = &cobra.Command{
+	Use:   "quota <id> <size>",
+	Short: "Cap the bytes uploaded with an API key, 0 uses the node default",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		quota, err := utils.ParseSize(args[1])
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if err := loadKeyStore().SetQuota(args[0], quota); err != nil {
+			log.Fatalln(err)
+		}
+		fmt.Printf("quota: %s %d\n", args[0], quota)
+	},
+}
+
+func apiKeysPath() string {
+	return filepath.Join(repoPath, "apikeys.json")
+}
+
+func loadKeyStore() *auth.KeyStore {
+	keys, err := auth.NewKeyStore(apiKeysPath())
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return keys
+}
+
+func init() {
+	apiKeyCreateCmd.Flags().StringVar(&apiKeyName, "name", "", "Label for the key")
+	apiKeyCreateCmd.Flags().StringSliceVar(&apiKeyScopes, "scopes", []string{"read"}, "Scopes granted to the key: read, write, admin")
+
+	apiKeyCreateCmd.Flags().StringVar(&apiKeyQuota, "quota", "", "Cap on the bytes uploaded with the key, such as 10GB")
+
+	apiKeyCmd.AddCommand(apiKeyCreateCmd, apiKeyListCmd, apiKeyRevokeCmd, apiKeyQuotaCmd)
+	rootCmd.AddCommand(apiKeyCmd)
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+var (
+	apiURL string
+	apiKey string
+)
+
+// apiGet calls the REST API of a running node and decodes the JSON reply.
+// A unix:///path URL talks to the node over its API socket.
+func apiGet(path string, out any) error {
+	base, client := apiURL, http.DefaultClient
+	if socket, ok := strings.CutPrefix(apiURL, "unix://"); ok {
+		base = "http://unix"
+		client = &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+			},
+		}}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(base, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, out)
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&apiURL, "api-url", "http://localhost:8080", "REST API of the node to talk to, or unix:///path for its socket")
+	rootCmd.PersistentFlags().StringVar(&apiKey, "api-key", os.Getenv("OBSCURE_FS_API_KEY"), "API key for --api-url, defaults to $OBSCURE_FS_API_KEY")
+}
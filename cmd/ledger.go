@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/gokul656/obscure-fs/internal/networking"
+	"github.com/spf13/cobra"
+)
+
+var ledgerCmd = &cobra.Command{
+	Use:   "ledger [peer]",
+	Short: "Show the bytes exchanged with each peer",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var entries []networking.LedgerEntry
+		if len(args) == 1 {
+			var entry networking.LedgerEntry
+			if err := apiGet("/ledger/"+args[0], &entry); err != nil {
+				log.Fatalf("Failed to read ledger: %v\n", err)
+			}
+			entries = append(entries, entry)
+		} else {
+			var reply struct {
+				Peers []networking.LedgerEntry `json:"peers"`
+			}
+			if err := apiGet("/ledger", &reply); err != nil {
+				log.Fatalf("Failed to read ledger: %v\n", err)
+			}
+			entries = reply.Peers
+		}
+
+		for _, e := range entries {
+			flag := ""
+			if e.Freeloader {
+				flag = "\tfreeloader"
+			}
+			fmt.Printf("%s\tsent: %d\treceived: %d\tratio: %.2f%s\n", e.Peer, e.Sent, e.Received, e.Ratio(), flag)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(ledgerCmd)
+}
@@ -4,9 +4,12 @@ import (
 	"context"
 	"log"
 	"os"
+	"time"
 
+	"github.com/gokul656/obscure-fs/internal/api"
 	"github.com/gokul656/obscure-fs/internal/networking"
 	"github.com/gokul656/obscure-fs/internal/storage"
+	"github.com/gokul656/obscure-fs/utils"
 	"github.com/spf13/cobra"
 )
 
@@ -19,6 +22,51 @@ var (
 	listenPort int
 	apiPort    int
 	pkey       string
+	repoPath   string
+
+	authorizedPeers []string
+	swarmKey        string
+	apiAuth         bool
+	corsOrigins     []string
+	tlsOptions      api.TLSOptions
+	apiSocket       string
+
+	heartbeatInterval time.Duration
+	nodeOfflineAfter  time.Duration
+	nodeEvictAfter    time.Duration
+	gcInterval        time.Duration
+
+	nodeQuota      string
+	keyQuota       string
+	cacheQuota     string
+	cacheEviction  string
+	cacheReprovide bool
+	padding        string
+
+	replication      networking.ReplicationPolicy
+	replicatePrivate bool
+	repairInterval   time.Duration
+	proofInterval    time.Duration
+
+	profile           networking.Profile
+	capacity          string
+	placementStrategy string
+	rebalanceInterval time.Duration
+	rebalanceBudget   string
+	pinSyncInterval   time.Duration
+
+	ledgerSyncInterval time.Duration
+	titForTat          networking.TitForTat
+	titForTatGrace     string
+
+	uploadLimit       string
+	downloadLimit     string
+	peerUploadLimit   string
+	peerDownloadLimit string
+	backgroundWindows string
+
+	healthPolicy networking.HealthPolicy
+	timeouts     networking.Timeouts
 
 	bootstrapNodes = []string{
 		"/ip4/127.0.0.1/tcp/5001/p2p/QmeoE7T4kja3rUxrzSkFi561BxfAA3phWxFRQvAyJqpZou",
@@ -34,11 +82,5 @@ func Execute() {
 }
 
 func init() {
-	rootCmd.PersistentFlags().IntVar(&listenPort, "port", 0, "Port to listen on")
-	rootCmd.PersistentFlags().IntVar(&apiPort, "api-port", 8080, "Port for the REST API")
-	rootCmd.PersistentFlags().StringVar(&pkey, "pkey", "", "Private key path")
-
-	rootCmd.MarkPersistentFlagRequired("port")
-	rootCmd.MarkPersistentFlagRequired("api-port")
-	rootCmd.MarkPersistentFlagRequired("pkey")
+	rootCmd.PersistentFlags().StringVar(&repoPath, "repo", utils.RepoPath, "Directory holding the node state")
 }
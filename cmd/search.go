@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	searchTag     string
+	searchMIME    string
+	searchMinSize int64
+	searchMaxSize int64
+	searchScope   string
+)
+
+var searchCmd = &cobra.Command{
+	Use:   "search [terms...]",
+	Short: "Search files by name, tag, MIME type and size",
+	Run: func(cmd *cobra.Command, args []string) {
+		params := url.Values{}
+		params.Set("q", strings.Join(args, " "))
+		params.Set("scope", searchScope)
+		if searchTag != "" {
+			params.Set("tag", searchTag)
+		}
+		if searchMIME != "" {
+			params.Set("mime", searchMIME)
+		}
+		if searchMinSize > 0 {
+			params.Set("min_size", strconv.FormatInt(searchMinSize, 10))
+		}
+		if searchMaxSize > 0 {
+			params.Set("max_size", strconv.FormatInt(searchMaxSize, 10))
+		}
+
+		var reply struct {
+			Results []struct {
+				CID       string   `json:"cid"`
+				Name      string   `json:"name"`
+				Size      int64    `json:"size"`
+				MIME      string   `json:"mime"`
+				Tags      []string `json:"tags"`
+				Providers []string `json:"providers"`
+			} `json:"results"`
+		}
+		if err := apiGet("/search?"+params.Encode(), &reply); err != nil {
+			log.Fatalf("Search failed: %v\n", err)
+		}
+
+		for _, r := range reply.Results {
+			fmt.Printf("%s\t%s\t%d\t%s\t%s\n", r.CID, r.Name, r.Size, r.MIME, strings.Join(r.Tags, ","))
+			for _, p := range r.Providers {
+				fmt.Printf("\tprovider: %s\n", p)
+			}
+		}
+	},
+}
+
+func init() {
+	searchCmd.Flags().StringVar(&searchTag, "tag", "", "Only files with this tag")
+	searchCmd.Flags().StringVar(&searchMIME, "mime", "", "Only files whose MIME type starts with this")
+	searchCmd.Flags().Int64Var(&searchMinSize, "min-size", 0, "Minimum size in bytes")
+	searchCmd.Flags().Int64Var(&searchMaxSize, "max-size", 0, "Maximum size in bytes")
+	searchCmd.Flags().StringVar(&searchScope, "scope", "all", "Where to search: all, local or network")
+
+	rootCmd.AddCommand(searchCmd)
+}
@@ -3,13 +3,21 @@ package cmd
 import (
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gokul656/obscure-fs/internal/api"
+	"github.com/gokul656/obscure-fs/internal/auth"
+	"github.com/gokul656/obscure-fs/internal/codec"
 	"github.com/gokul656/obscure-fs/internal/networking"
+	"github.com/gokul656/obscure-fs/internal/pinset"
+	"github.com/gokul656/obscure-fs/internal/placement"
 	"github.com/gokul656/obscure-fs/internal/storage"
+	"github.com/gokul656/obscure-fs/internal/throttle"
 	"github.com/gokul656/obscure-fs/utils"
 	"github.com/spf13/cobra"
 )
@@ -23,52 +31,254 @@ var serveCmd = &cobra.Command{
 		if store == nil {
 			log.Println("Initializing file store...")
 			store = storage.NewFileStore()
+			quota, err := parseQuota()
+			if err != nil {
+				log.Fatalln(err)
+			}
+			store.SetQuota(quota)
 			log.Println("Sucessfully initialzied file store...")
 		}
 
+		if registry == nil {
+			var err error
+			registry, err = networking.NewNodeRegistry(filepath.Join(repoPath, "registry.json"))
+			if err != nil {
+				log.Fatalf("Failed to load node registry: %v\n", err)
+			}
+		}
+
 		if network == nil {
 			log.Println("Initializing network...")
 			if listenPort <= 0 {
 				log.Fatalf("Invalid port: %d\n", listenPort)
 			}
-			network = networking.NewNetwork(ctx, listenPort, pkey, bootstrapNodes, store)
+			gater, err := networking.NewGater(filepath.Join(repoPath, "gater.json"))
+			if err != nil {
+				log.Fatalf("Failed to load gater rules: %v\n", err)
+			}
+
+			cacheLimit, err := utils.ParseSize(cacheQuota)
+			if err != nil {
+				log.Fatalf("Invalid --cache-quota: %v\n", err)
+			}
+			policy, err := storage.ParseEvictionPolicy(cacheEviction)
+			if err != nil {
+				log.Fatalln(err)
+			}
+
+			paddingPolicy, err := codec.ParsePaddingPolicy(padding)
+			if err != nil {
+				log.Fatalf("Invalid --padding: %v\n", err)
+			}
+			strategy, err := placement.Parse(placementStrategy)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			rebalanceBandwidth, err := utils.ParseSize(rebalanceBudget)
+			if err != nil {
+				log.Fatalf("Invalid --rebalance-bandwidth: %v\n", err)
+			}
+			profile.Capacity, err = utils.ParseSize(capacity)
+			if err != nil {
+				log.Fatalf("Invalid --capacity: %v\n", err)
+			}
+			if profile.Capacity == 0 {
+				profile.Capacity = store.Quota().Node
+			}
+
+			ledger, err := networking.NewLedger(filepath.Join(repoPath, "ledger.json"))
+			if err != nil {
+				log.Fatalln(err)
+			}
+			titForTat.Grace, err = utils.ParseSize(titForTatGrace)
+			if err != nil {
+				log.Fatalf("Invalid --tit-for-tat-grace: %v\n", err)
+			}
+			go ledger.Monitor(ctx, ledgerSyncInterval)
+
+			throttler, err := parseThrottle()
+			if err != nil {
+				log.Fatalln(err)
+			}
+
+			opts := []networking.Option{
+				networking.WithGater(gater),
+				networking.WithCache(cacheLimit, policy),
+				networking.WithReplication(replication),
+				networking.WithPadding(paddingPolicy),
+				networking.WithProfile(profile),
+				networking.WithPlacement(strategy),
+				networking.WithRebalanceBandwidth(rebalanceBandwidth),
+				networking.WithLedger(ledger, titForTat),
+				networking.WithThrottle(throttler),
+				networking.WithHealthPolicy(healthPolicy),
+				networking.WithTimeouts(timeouts),
+				networking.WithRegistry(registry),
+			}
+			if cacheReprovide {
+				opts = append(opts, networking.WithCacheReprovide())
+			}
+			if replicatePrivate {
+				opts = append(opts, networking.WithPrivateReplication())
+			}
+			if swarmKey != "" {
+				opts = append(opts, networking.WithSwarmKey(swarmKey))
+			}
+			network = networking.NewNetwork(ctx, listenPort, pkey, bootstrapNodes, store, opts...)
+			for _, id := range authorizedPeers {
+				if err := network.AuthorizePeer(id); err != nil {
+					log.Fatalf("Invalid authorized peer %s: %v\n", id, err)
+				}
+			}
 			network.StartSimpleProtocol(utils.ProtocolID)
+			network.StartReplicaProtocol()
+			network.StartProofProtocol()
+			if err := network.StartFileAnnouncements(ctx); err != nil {
+				log.Fatalf("Failed to start file announcements: %v\n", err)
+			}
+			pins, err := pinset.NewSet(filepath.Join(repoPath, "pins.json"))
+			if err != nil {
+				log.Fatalf("Failed to load cluster pins: %v\n", err)
+			}
+			if pinSyncInterval <= 0 {
+				log.Fatalf("Invalid --pin-sync-interval: %s\n", pinSyncInterval)
+			}
+			if err := network.StartClusterPins(ctx, pins, pinSyncInterval); err != nil {
+				log.Fatalf("Failed to start cluster pins: %v\n", err)
+			}
+			if repairInterval > 0 {
+				go network.StartReplicaRepair(ctx, repairInterval, nodeOfflineAfter)
+			}
+			if proofInterval > 0 {
+				go network.StartProofChallenges(ctx, proofInterval)
+			}
+			if rebalanceInterval > 0 {
+				go network.StartRebalancer(ctx, rebalanceInterval)
+			}
+			if gcInterval > 0 {
+				go network.StartGarbageCollector(ctx, gcInterval)
+			}
+			go registry.Monitor(ctx, network, heartbeatInterval, nodeOfflineAfter, nodeEvictAfter)
+
+			apiScheme := "http"
+			if tlsOptions.Enabled() {
+				apiScheme = "https"
+			}
+			if err := network.StartNodeAnnouncements(ctx, apiScheme, apiPort, heartbeatInterval); err != nil {
+				log.Fatalf("Failed to start node announcements: %v\n", err)
+			}
 			log.Printf("Node ID: %s\n", network.GetHost().ID().String())
 			network.ConnectToBootstrapNodes()
-			network.AnnounceToPeers(network.GetHost().ID().String(), fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", listenPort))
 		}
 
-		if registry == nil {
-			registry = networking.NewNodeRegistry()
+		log.Printf("Node is listening on port %d. Press Ctrl+C to stop.\n", listenPort)
+
+		if tlsOptions.SelfSigned && tlsOptions.CertFile == "" {
+			tlsOptions.CertFile = filepath.Join(repoPath, "tls", "cert.pem")
+			tlsOptions.KeyFile = filepath.Join(repoPath, "tls", "key.pem")
 		}
 
-		log.Printf("Node is listening on port %d. Press Ctrl+C to stop.\n", listenPort)
+		if tlsOptions.ClientCAFile != "" && !tlsOptions.Enabled() {
+			log.Fatalln("--tls-client-ca requires --tls-cert or --tls-self-signed")
+		}
+
+		var keys *auth.KeyStore
+		if apiAuth {
+			var err error
+			keys, err = auth.NewKeyStore(apiKeysPath())
+			if err != nil {
+				log.Fatalf("Failed to load API keys: %v\n", err)
+			}
+			if len(keys.List()) == 0 {
+				log.Println("No API keys configured, create one with `obscure-fs apikey create`")
+			}
+		} else {
+			log.Println("API authentication is disabled")
+		}
+
+		read := api.RequireScope(keys, auth.ScopeRead)
+		write := api.RequireScope(keys, auth.ScopeWrite)
+		admin := api.RequireScope(keys, auth.ScopeAdmin)
 
 		router := gin.Default()
-		router.Use(func(c *gin.Context) {
-			c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-			c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-			c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-			c.Next()
-		})
+		router.Use(api.CORS(corsOrigins))
 
 		nodeController := api.NewNodeController(ctx, store, registry, network)
 
 		nodes := router.Group("/nodes")
+		// accepts the same signed registration that nodes gossip, no API key
 		nodes.POST("/register", nodeController.RegisterNodeHandler)
-		nodes.GET("/", nodeController.GetAllNodesHandler)
+		nodes.GET("/", read, nodeController.GetAllNodesHandler)
+		nodes.GET("/health", read, nodeController.PeerHealthHandler)
+		nodes.DELETE("/:id/flag", admin, nodeController.UnflagNodeHandler)
 
 		files := router.Group("/files")
-		files.GET("/", nodeController.GetFilesHandler)
-		files.POST("/upload", nodeController.FileUploadsHandler)
-		files.GET("/:cid", nodeController.GetFileHandler)
+		files.GET("/", read, nodeController.GetFilesHandler)
+		files.POST("/upload", write, nodeController.FileUploadsHandler)
+		readContent := api.RequireScopeOrCapability(keys, auth.ScopeRead)
+		files.GET("/:cid", readContent, nodeController.GetFileHandler)
+		files.HEAD("/:cid", readContent, nodeController.HeadFileHandler)
+		files.GET("/:cid/stat", readContent, nodeController.StatFileHandler)
+		files.GET("/:cid/placement", read, nodeController.PlacementHandler)
+		files.POST("/:cid/verify", admin, nodeController.VerifyHoldersHandler)
+		files.POST("/:cid/visibility", write, nodeController.SetVisibilityHandler)
+		files.DELETE("/:cid", write, nodeController.DeleteFileHandler)
+		files.POST("/:cid/pin", write, nodeController.PinFileHandler)
+		files.DELETE("/:cid/pin", write, nodeController.UnpinFileHandler)
+
+		pins := router.Group("/pins")
+		pins.GET("/", read, nodeController.GetPinsHandler)
+		pins.POST("/", write, nodeController.ClusterPinHandler)
+		pins.DELETE("/:cid", write, nodeController.ClusterUnpinHandler)
+
+		router.POST("/gc", admin, nodeController.GarbageCollectHandler)
+		router.GET("/usage", read, nodeController.UsageHandler)
+		router.GET("/rebalance", read, nodeController.RebalanceStatusHandler)
+		router.POST("/rebalance", admin, nodeController.StartRebalanceHandler)
+
+		router.GET("/throttle", read, nodeController.ThrottleHandler)
+		router.GET("/ledger", read, nodeController.LedgerHandler)
+		router.GET("/ledger/:id", read, nodeController.PeerLedgerHandler)
+
+		router.GET("/search", read, nodeController.SearchHandler)
+		router.POST("/tokens", admin, nodeController.IssueTokenHandler)
+
+		gater := router.Group("/gater", admin)
+		gater.GET("/", nodeController.GetGaterHandler)
+		gater.POST("/:list", nodeController.AddGaterRulesHandler)
+		gater.DELETE("/:list", nodeController.RemoveGaterRulesHandler)
+
+		server := &http.Server{Addr: fmt.Sprintf(":%d", apiPort), Handler: router}
+		if tlsOptions.Enabled() {
+			tlsConfig, err := tlsOptions.Config()
+			if err != nil {
+				log.Fatalf("Failed to configure TLS: %v\n", err)
+			}
+			server.TLSConfig = tlsConfig
+		}
 
 		go func() {
-			if err := router.Run(fmt.Sprintf(":%d", apiPort)); err != nil {
+			var err error
+			if server.TLSConfig != nil {
+				log.Printf("Serving HTTPS API on %s\n", server.Addr)
+				err = server.ListenAndServeTLS("", "")
+			} else {
+				err = server.ListenAndServe()
+			}
+			if err != nil {
 				log.Fatalf("Failed to start HTTP server: %v", err)
 			}
 		}()
 
+		if apiSocket != "" {
+			go func() {
+				log.Printf("Serving API on unix socket %s\n", apiSocket)
+				if err := api.ServeUnixSocket(apiSocket, router); err != nil {
+					log.Fatalf("Failed to serve unix socket: %v", err)
+				}
+			}()
+		}
+
 		shutdown := make(chan os.Signal, 1)
 		signal.Notify(shutdown, os.Interrupt)
 		<-shutdown
@@ -81,6 +291,107 @@ var serveCmd = &cobra.Command{
 	},
 }
 
+func parseQuota() (storage.Quota, error) {
+	var quota storage.Quota
+	var err error
+	if quota.Node, err = utils.ParseSize(nodeQuota); err != nil {
+		return quota, fmt.Errorf("invalid --quota: %w", err)
+	}
+	if quota.PerUploader, err = utils.ParseSize(keyQuota); err != nil {
+		return quota, fmt.Errorf("invalid --key-quota: %w", err)
+	}
+	return quota, nil
+}
+
+func parseThrottle() (*throttle.Throttler, error) {
+	var limits throttle.Limits
+	for _, limit := range []struct {
+		flag  string
+		value string
+		out   *int64
+	}{
+		{"upload-limit", uploadLimit, &limits.Upload},
+		{"download-limit", downloadLimit, &limits.Download},
+		{"peer-upload-limit", peerUploadLimit, &limits.PeerUpload},
+		{"peer-download-limit", peerDownloadLimit, &limits.PeerDownload},
+	} {
+		var err error
+		if *limit.out, err = utils.ParseSize(limit.value); err != nil {
+			return nil, fmt.Errorf("invalid --%s: %w", limit.flag, err)
+		}
+	}
+
+	windows, err := throttle.ParseWindows(backgroundWindows)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --background-windows: %w", err)
+	}
+	return throttle.New(limits, windows), nil
+}
+
 func init() {
+	serveCmd.Flags().IntVar(&listenPort, "port", 0, "Port to listen on")
+	serveCmd.Flags().IntVar(&apiPort, "api-port", 8080, "Port for the REST API")
+	serveCmd.Flags().StringVar(&pkey, "pkey", "", "Private key path")
+	serveCmd.Flags().StringSliceVar(&bootstrapNodes, "bootstrap", bootstrapNodes, "Multiaddrs of the nodes to bootstrap from")
+	serveCmd.Flags().StringVar(&swarmKey, "swarm-key", "", "Pre-shared swarm key path, enables private networking")
+	serveCmd.Flags().StringSliceVar(&authorizedPeers, "authorized-peers", nil, "Peer IDs allowed to retrieve private files")
+	serveCmd.Flags().BoolVar(&apiAuth, "api-auth", true, "Require API keys on the REST API")
+	serveCmd.Flags().StringSliceVar(&corsOrigins, "cors-origins", []string{"*"}, "Origins allowed to call the REST API")
+
+	serveCmd.Flags().StringVar(&tlsOptions.CertFile, "tls-cert", "", "TLS certificate for the REST API")
+	serveCmd.Flags().StringVar(&tlsOptions.KeyFile, "tls-key", "", "TLS private key for the REST API")
+	serveCmd.Flags().BoolVar(&tlsOptions.SelfSigned, "tls-self-signed", false, "Serve TLS with a self-signed certificate kept in the repo")
+	serveCmd.Flags().StringVar(&tlsOptions.ClientCAFile, "tls-client-ca", "", "CA for client certificates, enables mutual TLS")
+	serveCmd.Flags().StringVar(&apiSocket, "api-socket", "", "Unix socket to serve the REST API on for local use")
+
+	serveCmd.Flags().DurationVar(&heartbeatInterval, "heartbeat-interval", 30*time.Second, "How often registered nodes are pinged")
+	serveCmd.Flags().DurationVar(&nodeOfflineAfter, "node-offline-after", 2*time.Minute, "Mark a node offline after being unreachable this long")
+	serveCmd.Flags().DurationVar(&nodeEvictAfter, "node-evict-after", 24*time.Hour, "Remove a node after being unreachable this long")
+
+	serveCmd.Flags().DurationVar(&gcInterval, "gc-interval", time.Hour, "How often unpinned files are garbage collected, 0 disables it")
+
+	serveCmd.Flags().StringVar(&nodeQuota, "quota", "", "Cap on the bytes stored by the node, such as 100GB")
+	serveCmd.Flags().StringVar(&keyQuota, "key-quota", "", "Default cap on the bytes uploaded with each API key")
+	serveCmd.Flags().StringVar(&cacheQuota, "cache-quota", "", "Cap on the bytes cached from network retrievals")
+	serveCmd.Flags().StringVar(&cacheEviction, "cache-eviction", string(storage.LRU), "Cache eviction policy: lru or lfu")
+	serveCmd.Flags().StringVar(&padding, "padding", "none", "Padding of the shards uploads are stored in: none, pow2 or bucket:<bytes>")
+	serveCmd.Flags().BoolVar(&cacheReprovide, "cache-reprovide", false, "Advertise cached public content on the DHT and serve it to peers")
+
+	serveCmd.Flags().IntVar(&replication.Factor, "replication-factor", 1, "Nodes that should hold each upload, this one included")
+	serveCmd.Flags().BoolVar(&replicatePrivate, "replicate-private", false, "Also replicate private uploads, peers store them in plaintext")
+	serveCmd.Flags().IntVar(&replication.Quorum, "write-quorum", 0, "Copies that must be stored before an upload succeeds, 0 for a majority")
+	serveCmd.Flags().DurationVar(&repairInterval, "repair-interval", time.Minute, "How often replicated files are checked for missing copies, 0 disables it")
+
+	serveCmd.Flags().StringVar(&profile.Zone, "zone", "", "Zone label advertised for placement, copies are spread across zones")
+	serveCmd.Flags().StringVar(&profile.Role, "role", networking.RoleStorage, "Node role: storage, or gateway to hold no replicas")
+	serveCmd.Flags().StringVar(&capacity, "capacity", "", "Storage capacity advertised for placement, defaults to --quota")
+	serveCmd.Flags().StringVar(&placementStrategy, "placement", "rendezvous", "Placement strategy for replicas: rendezvous or random")
+
+	serveCmd.Flags().DurationVar(&proofInterval, "proof-interval", time.Hour, "How often the holders of each replicated file are challenged to prove they still have it, 0 disables it")
+	serveCmd.Flags().DurationVar(&rebalanceInterval, "rebalance-interval", time.Hour, "How often replicas are moved to where placement wants them, 0 disables it")
+	serveCmd.Flags().StringVar(&rebalanceBudget, "rebalance-bandwidth", "10MB", "Bytes per second a rebalance may move on average, 0 for unlimited")
+	serveCmd.Flags().DurationVar(&ledgerSyncInterval, "ledger-sync-interval", 30*time.Second, "How often the bytes exchanged with each peer are persisted")
+	serveCmd.Flags().Float64Var(&titForTat.Ratio, "tit-for-tat-ratio", 0, "Deprioritize peers that returned less than this share of the bytes sent to them, 0 disables it")
+	serveCmd.Flags().StringVar(&titForTatGrace, "tit-for-tat-grace", "64MB", "Bytes sent to a peer before tit-for-tat applies to it")
+	serveCmd.Flags().StringVar(&uploadLimit, "upload-limit", "0", "Bytes per second sent to all peers together, 0 for unlimited")
+	serveCmd.Flags().StringVar(&downloadLimit, "download-limit", "0", "Bytes per second received from all peers together, 0 for unlimited")
+	serveCmd.Flags().StringVar(&peerUploadLimit, "peer-upload-limit", "0", "Bytes per second sent to each peer, 0 for unlimited")
+	serveCmd.Flags().StringVar(&peerDownloadLimit, "peer-download-limit", "0", "Bytes per second received from each peer, 0 for unlimited")
+	serveCmd.Flags().StringVar(&backgroundWindows, "background-windows", "", "Local times background transfers may start in, such as 22:00-06:00, any time when empty")
+	serveCmd.Flags().IntVar(&healthPolicy.Retries, "retries", networking.DefaultHealthPolicy.Retries, "Extra rounds over the providers of a file when all of them failed")
+	serveCmd.Flags().DurationVar(&healthPolicy.BaseBackoff, "retry-backoff", networking.DefaultHealthPolicy.BaseBackoff, "Wait before the first retry, doubled for every later one")
+	serveCmd.Flags().DurationVar(&healthPolicy.MaxBackoff, "retry-max-backoff", networking.DefaultHealthPolicy.MaxBackoff, "Longest wait between retries")
+	serveCmd.Flags().IntVar(&healthPolicy.FailureThreshold, "circuit-threshold", networking.DefaultHealthPolicy.FailureThreshold, "Consecutive failures after which a peer is skipped")
+	serveCmd.Flags().DurationVar(&healthPolicy.Cooldown, "circuit-cooldown", networking.DefaultHealthPolicy.Cooldown, "How long a failing peer is skipped before it is tried again")
+	serveCmd.Flags().DurationVar(&timeouts.Lookup, "lookup-timeout", networking.DefaultTimeouts.Lookup, "Longest DHT lookup for a peer or the providers of a file, 0 for no limit")
+	serveCmd.Flags().DurationVar(&timeouts.Announce, "announce-timeout", networking.DefaultTimeouts.Announce, "Longest time advertising a file on the DHT may take, 0 for no limit")
+	serveCmd.Flags().DurationVar(&timeouts.Request, "request-timeout", networking.DefaultTimeouts.Request, "Longest request to a peer that moves no content, such as a stat, 0 for no limit")
+	serveCmd.Flags().DurationVar(&timeouts.Transfer, "transfer-timeout", networking.DefaultTimeouts.Transfer, "Longest retrieval of a file from one provider, 0 for no limit")
+	serveCmd.Flags().DurationVar(&pinSyncInterval, "pin-sync-interval", time.Minute, "How often the cluster pin set is published and the pins this node holds are fetched")
+
+	serveCmd.MarkFlagRequired("port")
+	serveCmd.MarkFlagRequired("api-port")
+	serveCmd.MarkFlagRequired("pkey")
+
 	rootCmd.AddCommand(serveCmd)
 }
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gokul656/obscure-fs/internal/auth"
+)
+
+const (
+	apiKeyHeader = "X-API-Key"
+
+	// apiKeyContextKey holds the authenticated auth.APIKey, if any.
+	apiKeyContextKey = "api_key"
+	// capabilityOnlyKey is set when a request got in on a bearer token alone.
+	capabilityOnlyKey = "capability_only"
+)
+
+// RequireScope rejects requests without an API key or client certificate
+// granting scope. A nil key store disables authentication.
+func RequireScope(keys *auth.KeyStore, scope auth.Scope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if keys == nil {
+			c.Next()
+			return
+		}
+		if fromLocalSocket(c.Request) {
+			c.Set(apiKeyContextKey, auth.APIKey{ID: "local", Name: "unix socket", Scopes: []auth.Scope{auth.ScopeAdmin}})
+			c.Next()
+			return
+		}
+
+		key, ok := clientCertKey(c.Request)
+		if !ok {
+			key, ok = keys.Authenticate(c.GetHeader(apiKeyHeader))
+		}
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing or invalid API key"})
+			return
+		}
+		if !key.HasScope(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API key lacks scope: " + string(scope)})
+			return
+		}
+
+		c.Set(apiKeyContextKey, key)
+		c.Next()
+	}
+}
+
+// RequireScopeOrCapability lets requests carrying a capability bearer token
+// through without an API key, the handler has to verify the token.
+func RequireScopeOrCapability(keys *auth.KeyStore, scope auth.Scope) gin.HandlerFunc {
+	requireScope := RequireScope(keys, scope)
+	return func(c *gin.Context) {
+		if keys != nil && !fromLocalSocket(c.Request) && c.GetHeader(apiKeyHeader) == "" && bearerToken(c) != "" {
+			c.Set(capabilityOnlyKey, true)
+			c.Next()
+			return
+		}
+		requireScope(c)
+	}
+}
+
+func CORS(origins []string) gin.HandlerFunc {
+	wildcard := slices.Contains(origins, "*")
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		switch {
+		case wildcard:
+			c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+		case origin != "" && slices.Contains(origins, origin):
+			c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+			c.Writer.Header().Add("Vary", "Origin")
+		}
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, POST, DELETE, OPTIONS")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", strings.Join([]string{"Content-Type", "Authorization", apiKeyHeader}, ", "))
+
+		if c.Request.Method == http.MethodOptions {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
@@ -1,17 +1,48 @@
 package api
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/gokul656/obscure-fs/utils"
+	"github.com/gokul656/obscure-fs/internal/auth"
+	"github.com/gokul656/obscure-fs/internal/codec"
+	"github.com/gokul656/obscure-fs/internal/networking"
+	"github.com/gokul656/obscure-fs/internal/storage"
 )
 
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+	uploadDir       = "./uploads"
+)
+
+// saveUpload saves file under a name of its own in the upload directory,
+// so that uploads with the same name never overwrite each other.
+func saveUpload(c *gin.Context, file *multipart.FileHeader) (string, error) {
+	if err := os.MkdirAll(uploadDir, 0755); err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(uploadDir, "*-"+file.Filename)
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+
+	if err := c.SaveUploadedFile(file, f.Name()); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
 func (nc *NodeController) FileUploadsHandler(c *gin.Context) {
 	file, err := c.FormFile("file")
 	if err != nil {
@@ -19,88 +50,375 @@ func (nc *NodeController) FileUploadsHandler(c *gin.Context) {
 		return
 	}
 
-	uploadDir := "./uploads"
-	filePath := fmt.Sprintf("%s/%s", uploadDir, file.Filename)
-	if err := c.SaveUploadedFile(file, filePath); err != nil {
+	visibility, err := storage.ParseVisibility(c.PostForm("visibility"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	policy, err := nc.replicationPolicy(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	padding := nc.network.Padding()
+	if s := c.PostForm("padding"); s != "" {
+		if padding, err = codec.ParsePaddingPolicy(s); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	owner := uploader(c)
+	// checked again as the file is stored, this only spares saving it
+	if err := nc.store.CheckQuota(owner, keyQuota(c), file.Size); err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	}
+
+	filePath, err := saveUpload(c, file)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
 		return
 	}
+	// the saved file becomes the stored copy, any upload that is not
+	// stored leaves nothing behind
+	stored := false
+	defer func() {
+		if !stored {
+			os.Remove(filePath)
+		}
+	}()
+
+	mimeType, err := storage.DetectMIME(filePath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+
+	// the file is stored before it is announced, a client hanging up must
+	// not cut the announcement short, the announce timeout bounds it
+	cid, err := nc.network.ShareFile(context.WithoutCancel(c.Request.Context()), filePath, storage.FileEntry{
+		Visibility: visibility,
+		Name:       file.Filename,
+		MIME:       mimeType,
+		Tags:       parseTags(c.PostForm("tags")),
+		Uploader:   owner,
+		Pinned:     c.DefaultPostForm("pin", "true") != "false",
+		Replicas:   policy.Factor,
+		Codec:      storage.CodecInfo{Padding: padding.String()},
+	}, keyQuota(c))
+	if errors.Is(err, storage.ErrFileExists) {
+		// the stored copy keeps its entry, the upload is dropped
+		c.JSON(http.StatusOK, gin.H{"message": "File already stored", "cid": cid})
+		return
+	}
+	if errors.Is(err, storage.ErrQuotaExceeded) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to share file"})
+		return
+	}
+	stored = true
 
-	cid, err := nc.network.ShareFile(filePath)
+	replication, err := nc.network.Replicate(c.Request.Context(), cid, policy)
 	if err != nil {
+		// the file stays on this node, only the copies elsewhere fell short
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error(), "cid": cid, "replication": replication})
 		return
 	}
 
 	log.Printf("file uploaded: %s (CID: %s)\n", filePath, cid)
-	c.JSON(http.StatusOK, gin.H{"message": "File uploaded successfully", "cid": cid})
+	c.JSON(http.StatusOK, gin.H{"message": "File uploaded successfully", "cid": cid, "visibility": visibility, "replication": replication})
+}
+
+// replicationPolicy reads the replicas and quorum form fields, falling back
+// to the node's policy.
+func (nc *NodeController) replicationPolicy(c *gin.Context) (networking.ReplicationPolicy, error) {
+	policy := nc.network.ReplicationPolicy()
+	if s := c.PostForm("replicas"); s != "" {
+		factor, err := strconv.Atoi(s)
+		if err != nil || factor < 1 {
+			return policy, fmt.Errorf("invalid replicas: %s", s)
+		}
+		policy.Factor = factor
+		policy.Quorum = 0
+	}
+	if s := c.PostForm("quorum"); s != "" {
+		quorum, err := strconv.Atoi(s)
+		if err != nil || quorum < 1 || quorum > policy.Factor {
+			return policy, fmt.Errorf("invalid quorum: %s", s)
+		}
+		policy.Quorum = quorum
+	}
+	return policy, nil
+}
+
+// uploader identifies who made the request, by API key or certificate.
+func uploader(c *gin.Context) string {
+	value, ok := c.Get(apiKeyContextKey)
+	if !ok {
+		return "anonymous"
+	}
+
+	key := value.(auth.APIKey)
+	if key.Name != "" {
+		return fmt.Sprintf("%s (%s)", key.Name, key.ID)
+	}
+	return key.ID
+}
+
+// keyQuota is the upload quota of the request's API key, 0 when it has none.
+func keyQuota(c *gin.Context) int64 {
+	value, ok := c.Get(apiKeyContextKey)
+	if !ok {
+		return 0
+	}
+	return value.(auth.APIKey).Quota
+}
+
+func parseTags(s string) []string {
+	tags := make([]string, 0)
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func (nc *NodeController) SetVisibilityHandler(c *gin.Context) {
+	var body struct {
+		Visibility string `json:"visibility"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	visibility, err := storage.ParseVisibility(body.Visibility)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cid := c.Param("cid")
+	if err := nc.network.SetVisibility(context.WithoutCancel(c.Request.Context()), cid, visibility); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"cid": cid, "visibility": visibility})
+}
+
+// authorizeContent aborts the request unless it may read cid. Without an
+// API key, private content and anything requested on a bearer alone needs a
+// capability issued by this node.
+func (nc *NodeController) authorizeContent(c *gin.Context, cid string) bool {
+	_, authenticated := c.Get(apiKeyContextKey)
+	capabilityOnly := c.GetBool(capabilityOnlyKey)
+
+	entry, err := nc.store.GetEntry(cid)
+	if capabilityOnly && err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Capability tokens only cover content held by this node"})
+		return false
+	}
+	if err == nil && !authenticated && (entry.Visibility == storage.Private || capabilityOnly) {
+		if err := nc.network.VerifyToken(bearerToken(c), cid, ""); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return false
+		}
+	}
+	return true
 }
 
 func (nc *NodeController) GetFileHandler(c *gin.Context) {
 	cid := c.Param("cid")
+	token := bearerToken(c)
+	if !nc.authorizeContent(c, cid) {
+		return
+	}
+
+	f, temporary, err := nc.network.Fetch(c.Request.Context(), cid, token)
+	if err != nil {
+		c.JSON(lookupStatus(err), gin.H{"error": "File not found"})
+		return
+	}
+	if temporary {
+		defer os.Remove(f.Name())
+	}
+	defer f.Close()
+
+	// served from the open file, a cached copy may be evicted meanwhile
+	info, err := f.Stat()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+	http.ServeContent(c.Writer, c.Request, cid, info.ModTime(), f)
+}
+
+// lookupStatus is the status of a file that could not be found, a lookup
+// that ran out of time does not prove the file is missing.
+func lookupStatus(err error) int {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusNotFound
+}
+
+func (nc *NodeController) GetFilesHandler(c *gin.Context) {
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultPageSize)))
+	if err != nil || limit <= 0 || limit > maxPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+
+	networkFiles, total := nc.network.Catalog().List(offset, limit)
+	c.JSON(http.StatusOK, gin.H{
+		"local_files":   nc.store.ListFiles(),
+		"network_files": networkFiles,
+		"total":         total,
+		"offset":        offset,
+		"limit":         limit,
+	})
+}
 
-	tempDir := fmt.Sprintf("./temp/%s", nc.network.GetHost().ID())
-	tempFilePath := fmt.Sprintf("%s/%s", tempDir, cid)
+func (nc *NodeController) StatFileHandler(c *gin.Context) {
+	cid := c.Param("cid")
+	if !nc.authorizeContent(c, cid) {
+		return
+	}
 
-	if err := os.MkdirAll(tempDir, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create temp directory"})
+	stat, err := nc.network.StatFile(c.Request.Context(), cid, bearerToken(c))
+	if err != nil {
+		c.JSON(lookupStatus(err), gin.H{"error": "File not found"})
 		return
 	}
+	c.JSON(http.StatusOK, stat)
+}
 
-	err := nc.network.RetrieveFile(cid, tempFilePath)
+// PlacementHandler shows where the copies of a file should go and where
+// they are.
+func (nc *NodeController) PlacementHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, nc.network.Placement(c.Param("cid")))
+}
+
+// VerifyHoldersHandler challenges every holder of a file to prove it still
+// has its copy.
+func (nc *NodeController) VerifyHoldersHandler(c *gin.Context) {
+	results, err := nc.network.VerifyHolders(c.Request.Context(), c.Param("cid"))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
 		return
 	}
-
-	c.File(tempFilePath)
+	c.JSON(http.StatusOK, gin.H{"cid": c.Param("cid"), "results": results})
 }
 
-func (n *NodeController) GetFilesHandler(c *gin.Context) {
-	localFiles := n.store.ListFiles()
+func (nc *NodeController) RebalanceStatusHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, nc.network.RebalanceStatus())
+}
 
-	response := gin.H{
-		"local_files":   localFiles,
-		"network_files": []gin.H{},
+// StartRebalanceHandler starts a rebalance in the background, its progress
+// is reported by RebalanceStatusHandler.
+func (nc *NodeController) StartRebalanceHandler(c *gin.Context) {
+	if nc.network.RebalanceStatus().Running {
+		c.JSON(http.StatusConflict, gin.H{"error": networking.ErrRebalanceRunning.Error()})
+		return
 	}
 
-	// Fetch files available on the network
-	networkPeers := n.network.GetHost().Peerstore().Peers()
-	for _, peerID := range networkPeers {
-		if peerID == n.network.GetHost().ID() {
-			continue
+	go func() {
+		if err := nc.network.Rebalance(nc.ctx); err != nil {
+			log.Printf("rebalance failed: %v\n", err)
 		}
+	}()
+	c.JSON(http.StatusAccepted, gin.H{"message": "Rebalance started"})
+}
 
-		stream, err := n.network.GetHost().NewStream(n.ctx, peerID, utils.ProtocolID)
-		if err != nil {
-			log.Printf("Failed to create stream to peer %s: %v\n", peerID, err)
-			continue
-		}
-		defer stream.Close()
+// HeadFileHandler answers with the headers GetFileHandler would send,
+// without fetching the content.
+func (nc *NodeController) HeadFileHandler(c *gin.Context) {
+	cid := c.Param("cid")
+	if !nc.authorizeContent(c, cid) {
+		return
+	}
 
-		_, err = stream.Write([]byte("list_files")) // Protocol to list files
-		if err != nil {
-			log.Printf("Failed to request files from peer %s: %v\n", peerID, err)
-			continue
-		}
+	stat, err := nc.network.StatFile(c.Request.Context(), cid, bearerToken(c))
+	if err != nil {
+		c.Status(lookupStatus(err))
+		return
+	}
 
-		// Read response
-		peerFileData, err := io.ReadAll(stream)
-		if err != nil {
-			log.Printf("Failed to read files from peer %s: %v\n", peerID, err)
-			continue
-		}
+	// the size of a padded file is only an upper bound
+	if stat.Padding == "" {
+		c.Header("Content-Length", strconv.FormatInt(stat.Size, 10))
+	}
+	c.Header("Content-Type", stat.MIME)
+	c.Header("ETag", fmt.Sprintf("%q", cid))
+	c.Header("X-Content-CID", cid)
+	c.Header("X-Content-Provider", stat.Provider)
+	if !stat.UploadedAt.IsZero() {
+		c.Header("Last-Modified", stat.UploadedAt.UTC().Format(http.TimeFormat))
+	}
+	c.Status(http.StatusOK)
+}
 
-		var peerFiles map[string]string
-		if err := json.Unmarshal(peerFileData, &peerFiles); err != nil {
-			log.Printf("Failed to decode files from peer %s: %v\n", peerID, err)
-			continue
-		}
+func (nc *NodeController) DeleteFileHandler(c *gin.Context) {
+	cid := c.Param("cid")
+	result, err := nc.network.DeleteFile(cid)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (nc *NodeController) PinFileHandler(c *gin.Context) {
+	cid := c.Param("cid")
+	if err := nc.store.Pin(cid); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"cid": cid, "pinned": true})
+}
+
+func (nc *NodeController) UnpinFileHandler(c *gin.Context) {
+	cid := c.Param("cid")
+	if err := nc.store.Unpin(cid); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"cid": cid, "pinned": false})
+}
+
+func (nc *NodeController) GarbageCollectHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, nc.network.CollectGarbage())
+}
+
+// UsageHandler reports the storage used against the node, API key and
+// retrieval cache quotas.
+func (nc *NodeController) UsageHandler(c *gin.Context) {
+	owner := uploader(c)
+	quota := nc.store.Quota()
+	node, byOwner := nc.store.Usage(owner)
 
-		response["network_files"] = append(response["network_files"].([]gin.H), gin.H{
-			"peer_id": peerID.String(),
-			"files":   peerFiles,
-		})
+	ownerLimit := keyQuota(c)
+	if ownerLimit == 0 {
+		ownerLimit = quota.PerUploader
 	}
 
-	c.JSON(http.StatusOK, response)
+	c.JSON(http.StatusOK, gin.H{
+		"node":     gin.H{"used": node, "limit": quota.Node},
+		"uploader": gin.H{"name": owner, "used": byOwner, "limit": ownerLimit},
+		"cache":    nc.network.Cache().Usage(),
+	})
 }
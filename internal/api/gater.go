@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gokul656/obscure-fs/internal/networking"
+)
+
+func (nc *NodeController) GetGaterHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, nc.network.Gater().Rules())
+}
+
+func (nc *NodeController) AddGaterRulesHandler(c *gin.Context) {
+	var rules networking.GaterRules
+	if err := c.ShouldBindJSON(&rules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if err := nc.network.Gater().Add(c.Param("list"), rules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	nc.network.EnforceGater()
+	c.JSON(http.StatusOK, nc.network.Gater().Rules())
+}
+
+func (nc *NodeController) RemoveGaterRulesHandler(c *gin.Context) {
+	var rules networking.GaterRules
+	if err := c.ShouldBindJSON(&rules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if err := nc.network.Gater().Remove(c.Param("list"), rules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	nc.network.EnforceGater()
+	c.JSON(http.StatusOK, nc.network.Gater().Rules())
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gokul656/obscure-fs/internal/networking"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// LedgerHandler lists the bytes exchanged with every peer, the ones sent
+// the most first.
+func (nc *NodeController) LedgerHandler(c *gin.Context) {
+	peers := nc.network.Ledger()
+	if peers == nil {
+		peers = []networking.LedgerEntry{}
+	}
+	c.JSON(http.StatusOK, gin.H{"peers": peers, "tit_for_tat": nc.network.TitForTat()})
+}
+
+func (nc *NodeController) PeerLedgerHandler(c *gin.Context) {
+	id, err := peer.Decode(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid peer ID"})
+		return
+	}
+
+	entry, err := nc.network.LedgerEntry(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
@@ -26,17 +26,39 @@ func NewNodeController(ctx context.Context, store *storage.FileStore, registry *
 }
 
 func (nc *NodeController) RegisterNodeHandler(c *gin.Context) {
-	var node networking.Node
-	if err := c.ShouldBindJSON(&node); err != nil {
+	var reg networking.SignedRegistration
+	if err := c.ShouldBindJSON(&reg); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
 
-	nc.registry.RegisterNode(node)
-	c.JSON(http.StatusOK, gin.H{"message": "Node registered successfully", "node_id": node.ID})
+	if err := reg.Verify(); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	nc.registry.RegisterNode(reg.Node)
+	c.JSON(http.StatusOK, gin.H{"message": "Node registered successfully", "node_id": reg.Node.ID})
 }
 
 func (nc *NodeController) GetAllNodesHandler(c *gin.Context) {
 	nodes := nc.registry.GetAllNodes()
 	c.JSON(http.StatusOK, gin.H{"nodes": nodes})
 }
+
+// UnflagNodeHandler lifts the flag a node got for failing a storage proof.
+func (nc *NodeController) UnflagNodeHandler(c *gin.Context) {
+	id := c.Param("id")
+	if !nc.registry.Unflag(id) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Node is not flagged"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"node_id": id, "flagged": false})
+}
+
+// PeerHealthHandler lists the peers requests were made to with their score
+// and circuit state.
+func (nc *NodeController) PeerHealthHandler(c *gin.Context) {
+	health := nc.network.Health()
+	c.JSON(http.StatusOK, gin.H{"peers": health.Peers(), "policy": health.Policy()})
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gokul656/obscure-fs/internal/pinset"
+)
+
+type clusterPinRequest struct {
+	CID      string `json:"cid" binding:"required"`
+	Name     string `json:"name"`
+	Replicas int    `json:"replicas"`
+	TTL      string `json:"ttl"`
+}
+
+// GetPinsHandler lists the cluster pin set, tombstones left out unless
+// ?all=true.
+func (nc *NodeController) GetPinsHandler(c *gin.Context) {
+	pins := nc.network.Pins().Active(time.Now())
+	if c.Query("all") == "true" {
+		pins = nc.network.Pins().All()
+	}
+	if pins == nil {
+		pins = []pinset.Pin{}
+	}
+	c.JSON(http.StatusOK, pins)
+}
+
+// ClusterPinHandler asks the cluster to keep a CID on as many nodes as
+// replicas, the node replication factor by default.
+func (nc *NodeController) ClusterPinHandler(c *gin.Context) {
+	var req clusterPinRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if req.Replicas < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid replicas"})
+		return
+	}
+	if req.Replicas == 0 {
+		req.Replicas = nc.network.ReplicationPolicy().Factor
+	}
+
+	pin := pinset.Pin{CID: req.CID, Name: req.Name, Replicas: req.Replicas}
+	if req.TTL != "" {
+		ttl, err := time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ttl"})
+			return
+		}
+		pin.Expires = time.Now().Add(ttl).UTC()
+	}
+
+	pin, err := nc.network.PinCluster(pin)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, pin)
+}
+
+func (nc *NodeController) ClusterUnpinHandler(c *gin.Context) {
+	pin, err := nc.network.UnpinCluster(c.Param("cid"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, pin)
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gokul656/obscure-fs/internal/search"
+)
+
+type searchResult struct {
+	search.Document
+	Local bool `json:"local"`
+}
+
+// SearchHandler queries the local store and the network catalog. Results
+// are merged by CID, local files list this node as a provider.
+func (nc *NodeController) SearchHandler(c *gin.Context) {
+	query := search.Query{
+		Text: c.Query("q"),
+		Tag:  c.Query("tag"),
+		MIME: c.Query("mime"),
+	}
+
+	var err error
+	if v := c.Query("min_size"); v != "" {
+		if query.MinSize, err = strconv.ParseInt(v, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid min_size"})
+			return
+		}
+	}
+	if v := c.Query("max_size"); v != "" {
+		if query.MaxSize, err = strconv.ParseInt(v, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid max_size"})
+			return
+		}
+	}
+
+	scope := c.DefaultQuery("scope", "all")
+	if scope != "all" && scope != "local" && scope != "network" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scope"})
+		return
+	}
+
+	self := nc.network.GetHost().ID().String()
+	results := make([]searchResult, 0)
+	positions := make(map[string]int)
+
+	if scope != "network" {
+		for _, doc := range nc.store.Search(query) {
+			doc.Providers = []string{self}
+			positions[doc.CID] = len(results)
+			results = append(results, searchResult{Document: doc, Local: true})
+		}
+	}
+
+	if scope != "local" {
+		for _, doc := range nc.network.Catalog().Search(query) {
+			if i, ok := positions[doc.CID]; ok {
+				results[i].Providers = append(results[i].Providers, doc.Providers...)
+				continue
+			}
+			positions[doc.CID] = len(results)
+			results = append(results, searchResult{Document: doc})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": results, "total": len(results)})
+}
@@ -0,0 +1,19 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ThrottleHandler shows the rate limits and whether background transfers
+// may start now.
+func (nc *NodeController) ThrottleHandler(c *gin.Context) {
+	t := nc.network.Throttle()
+	windows := []string{}
+	for _, w := range t.Windows() {
+		windows = append(windows, w.String())
+	}
+	c.JSON(http.StatusOK, gin.H{"limits": t.Limits(), "background_windows": windows, "in_window": t.InWindow(time.Now())})
+}
@@ -0,0 +1,210 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gokul656/obscure-fs/internal/auth"
+)
+
+type TLSOptions struct {
+	CertFile string
+	KeyFile  string
+	// SelfSigned creates CertFile and KeyFile when they do not exist yet.
+	SelfSigned bool
+	// ClientCAFile enables mutual TLS, client certificates signed by it are
+	// mapped to scopes through their OU fields.
+	ClientCAFile string
+}
+
+func (o TLSOptions) Enabled() bool {
+	return o.CertFile != "" || o.SelfSigned
+}
+
+func (o TLSOptions) Config() (*tls.Config, error) {
+	if o.SelfSigned {
+		if err := ensureSelfSigned(o.CertFile, o.KeyFile); err != nil {
+			return nil, fmt.Errorf("failed to create self-signed certificate: %w", err)
+		}
+	}
+
+	cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if o.ClientCAFile != "" {
+		caPEM, err := os.ReadFile(o.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in: %s", o.ClientCAFile)
+		}
+
+		// API keys keep working for clients without a certificate
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return cfg, nil
+}
+
+func ensureSelfSigned(certFile, keyFile string) error {
+	if _, err := os.Stat(certFile); err == nil {
+		return nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	hostname, _ := os.Hostname()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "obscure-fs"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost", hostname},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(certFile), 0755); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(keyFile), 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return err
+	}
+
+	log.Printf("generated self-signed certificate: %s\n", certFile)
+	return nil
+}
+
+// clientCertKey maps a verified client certificate to a key, its scopes are
+// taken from the certificate OU fields.
+func clientCertKey(r *http.Request) (auth.APIKey, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return auth.APIKey{}, false
+	}
+
+	cert := r.TLS.VerifiedChains[0][0]
+	var scopes []auth.Scope
+	for _, ou := range cert.Subject.OrganizationalUnit {
+		if parsed, err := auth.ParseScopes([]string{ou}); err == nil {
+			scopes = append(scopes, parsed...)
+		}
+	}
+	if len(scopes) == 0 {
+		return auth.APIKey{}, false
+	}
+
+	return auth.APIKey{
+		ID:     "cert:" + cert.SerialNumber.Text(16),
+		Name:   cert.Subject.CommonName,
+		Scopes: scopes,
+	}, true
+}
+
+type localSocketContextKey struct{}
+
+// ServeUnixSocket serves handler on a unix domain socket. Access is guarded
+// by file permissions, so requests on it get admin scope.
+func ServeUnixSocket(path string, handler http.Handler) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	listener, err := listenUnix(path)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Handler: handler,
+		ConnContext: func(ctx context.Context, _ net.Conn) context.Context {
+			return context.WithValue(ctx, localSocketContextKey{}, true)
+		},
+	}
+	return server.Serve(listener)
+}
+
+// listenUnix binds the socket inside a fresh 0700 directory, so nobody else
+// can connect before it is narrowed to 0600, then moves it to path.
+func listenUnix(path string) (*net.UnixListener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".socket-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, "api.sock")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmp, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	// the socket no longer lives at tmp once renamed, a stale one at path is
+	// removed on the next start
+	listener.SetUnlinkOnClose(false)
+
+	if err := os.Chmod(tmp, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+func fromLocalSocket(r *http.Request) bool {
+	local, _ := r.Context().Value(localSocketContextKey{}).(bool)
+	return local
+}
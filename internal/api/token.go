@@ -0,0 +1,50 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type issueTokenRequest struct {
+	CIDs     []string `json:"cids" binding:"required"`
+	TTL      string   `json:"ttl"`
+	Audience string   `json:"audience"`
+}
+
+func (nc *NodeController) IssueTokenHandler(c *gin.Context) {
+	var req issueTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	ttl := time.Hour
+	if req.TTL != "" {
+		var err error
+		ttl, err = time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ttl"})
+			return
+		}
+	}
+
+	token, err := nc.network.IssueToken(req.CIDs, ttl, req.Audience)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": token, "expires_at": time.Now().Add(ttl).Unix()})
+}
+
+func bearerToken(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	token, found := strings.CutPrefix(header, "Bearer ")
+	if !found {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
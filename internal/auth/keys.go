@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gokul656/obscure-fs/utils"
+)
+
+type Scope string
+
+const (
+	ScopeRead  Scope = "read"
+	ScopeWrite Scope = "write"
+	ScopeAdmin Scope = "admin"
+)
+
+// scopeRank orders scopes so that admin implies write and write implies read.
+var scopeRank = map[Scope]int{
+	ScopeRead:  1,
+	ScopeWrite: 2,
+	ScopeAdmin: 3,
+}
+
+func ParseScopes(values []string) ([]Scope, error) {
+	scopes := make([]Scope, 0, len(values))
+	for _, v := range values {
+		scope := Scope(strings.TrimSpace(v))
+		if _, ok := scopeRank[scope]; !ok {
+			return nil, fmt.Errorf("unknown scope: %s", v)
+		}
+		scopes = append(scopes, scope)
+	}
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	return scopes, nil
+}
+
+// APIKey is the stored form of a key, the secret itself is never persisted.
+type APIKey struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Hash      string    `json:"hash"`
+	Scopes    []Scope   `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+	// Quota caps the bytes uploaded with the key, 0 uses the node default.
+	Quota int64 `json:"quota,omitempty"`
+}
+
+func (k APIKey) HasScope(scope Scope) bool {
+	for _, s := range k.Scopes {
+		if scopeRank[s] >= scopeRank[scope] {
+			return true
+		}
+	}
+	return false
+}
+
+type KeyStore struct {
+	mu      sync.RWMutex
+	path    string
+	keys    []APIKey
+	modTime time.Time
+}
+
+func NewKeyStore(path string) (*KeyStore, error) {
+	ks := &KeyStore{path: path}
+	if err := ks.load(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+func (ks *KeyStore) load() error {
+	var keys []APIKey
+	if err := utils.ReadJSONFile(ks.path, &keys); err != nil {
+		return fmt.Errorf("failed to load API keys: %w", err)
+	}
+	ks.keys = keys
+	if info, err := os.Stat(ks.path); err == nil {
+		ks.modTime = info.ModTime()
+	}
+	return nil
+}
+
+// refresh picks up keys created or revoked by the CLI while a node runs.
+func (ks *KeyStore) refresh() {
+	info, err := os.Stat(ks.path)
+	if err != nil {
+		return
+	}
+
+	ks.mu.RLock()
+	changed := !info.ModTime().Equal(ks.modTime)
+	ks.mu.RUnlock()
+	if !changed {
+		return
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if err := ks.load(); err != nil {
+		log.Printf("failed to reload API keys: %v\n", err)
+	}
+}
+
+// Create generates a new key and returns its secret, which cannot be
+// recovered later.
+func (ks *KeyStore) Create(name string, scopes []Scope) (string, APIKey, error) {
+	id := make([]byte, 4)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", APIKey{}, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", APIKey{}, err
+	}
+
+	key := APIKey{
+		ID:        hex.EncodeToString(id),
+		Name:      name,
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+	}
+	plain := fmt.Sprintf("ofs_%s_%s", key.ID, hex.EncodeToString(secret))
+	key.Hash = hashKey(plain)
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.keys = append(ks.keys, key)
+	if err := ks.save(); err != nil {
+		return "", APIKey{}, err
+	}
+	return plain, key, nil
+}
+
+func (ks *KeyStore) Revoke(id string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	count := len(ks.keys)
+	ks.keys = slices.DeleteFunc(ks.keys, func(k APIKey) bool { return k.ID == id })
+	if len(ks.keys) == count {
+		return fmt.Errorf("API key not found: %s", id)
+	}
+	return ks.save()
+}
+
+func (ks *KeyStore) SetQuota(id string, quota int64) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	i := slices.IndexFunc(ks.keys, func(k APIKey) bool { return k.ID == id })
+	if i < 0 {
+		return fmt.Errorf("API key not found: %s", id)
+	}
+	ks.keys[i].Quota = quota
+	return ks.save()
+}
+
+func (ks *KeyStore) save() error {
+	if err := utils.WriteJSONFile(ks.path, ks.keys); err != nil {
+		return err
+	}
+	if info, err := os.Stat(ks.path); err == nil {
+		ks.modTime = info.ModTime()
+	}
+	return nil
+}
+
+func (ks *KeyStore) List() []APIKey {
+	ks.refresh()
+
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return slices.Clone(ks.keys)
+}
+
+func (ks *KeyStore) Authenticate(plain string) (APIKey, bool) {
+	if plain == "" {
+		return APIKey{}, false
+	}
+
+	hash := []byte(hashKey(plain))
+	ks.refresh()
+
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	for _, key := range ks.keys {
+		if subtle.ConstantTimeCompare(hash, []byte(key.Hash)) == 1 {
+			return key, true
+		}
+	}
+	return APIKey{}, false
+}
+
+func hashKey(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
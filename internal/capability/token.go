@@ -0,0 +1,124 @@
+package capability
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+var (
+	ErrMalformed    = errors.New("malformed capability token")
+	ErrBadSignature = errors.New("invalid capability signature")
+	ErrExpired      = errors.New("capability token expired")
+	ErrNotCovered   = errors.New("capability token does not cover CID")
+	ErrAudience     = errors.New("capability token issued to another peer")
+)
+
+// Capability grants read access to a set of CIDs until Expiry. It is signed
+// by the identity key of the issuing node, which is also the node that
+// verifies it before serving data.
+type Capability struct {
+	Issuer    string   `json:"iss"`
+	Audience  string   `json:"aud,omitempty"`
+	CIDs      []string `json:"cids"`
+	NotBefore int64    `json:"nbf"`
+	Expiry    int64    `json:"exp"`
+	Nonce     string   `json:"nonce"`
+}
+
+// Issue signs a capability for the given CIDs. An empty audience makes it a
+// bearer token usable by anyone holding it.
+func Issue(key crypto.PrivKey, cids []string, ttl time.Duration, audience string) (string, error) {
+	if len(cids) == 0 {
+		return "", errors.New("capability must cover at least one CID")
+	}
+
+	issuer, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	if audience != "" {
+		if _, err := peer.Decode(audience); err != nil {
+			return "", fmt.Errorf("invalid audience: %w", err)
+		}
+	}
+
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	payload, err := json.Marshal(Capability{
+		Issuer:    issuer.String(),
+		Audience:  audience,
+		CIDs:      cids,
+		NotBefore: now.Unix(),
+		Expiry:    now.Add(ttl).Unix(),
+		Nonce:     hex.EncodeToString(nonce),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sig, err := key.Sign(payload)
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(sig), nil
+}
+
+// Verify checks the token against the issuer key and returns the capability
+// if it grants cid to presenter. presenter is empty for HTTP bearers, which
+// can only use tokens without an audience.
+func Verify(key crypto.PubKey, token, cid string, presenter peer.ID) (*Capability, error) {
+	payloadPart, sigPart, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrMalformed
+	}
+
+	enc := base64.RawURLEncoding
+	payload, err := enc.DecodeString(payloadPart)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	sig, err := enc.DecodeString(sigPart)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	valid, err := key.Verify(payload, sig)
+	if err != nil || !valid {
+		return nil, ErrBadSignature
+	}
+
+	var capability Capability
+	if err := json.Unmarshal(payload, &capability); err != nil {
+		return nil, ErrMalformed
+	}
+
+	now := time.Now().Unix()
+	if now < capability.NotBefore || now >= capability.Expiry {
+		return nil, ErrExpired
+	}
+	if !slices.Contains(capability.CIDs, cid) {
+		return nil, ErrNotCovered
+	}
+	if capability.Audience != "" && capability.Audience != presenter.String() {
+		return nil, ErrAudience
+	}
+
+	return &capability, nil
+}
@@ -11,18 +11,31 @@ import (
 	"github.com/klauspost/reedsolomon"
 )
 
+// ErasureCodecName names the erasure codec in the codec info of an entry.
+const ErasureCodecName = "erasure"
+
 type Codec interface {
 	Encode(metadata *storage.Metadata, src []byte) error
 	Decode(metadata *storage.Metadata) error
 }
 
-type ErasureCodec struct{}
+type ErasureCodec struct {
+	// Padding is applied to the content before it is split into shards.
+	Padding PaddingPolicy
+}
 
-func (ErasureCodec) Encode(metadata *storage.Metadata, src []byte) (err error) {
+func (ec ErasureCodec) Encode(metadata *storage.Metadata, src []byte) (err error) {
 	log.Println("beginning encoding with default configs..")
 	log.Printf("shard size : %v\n", utils.Shards)
 	log.Printf("pairty size: %v\n", utils.Pairty)
 
+	metadata.Size = int64(len(src))
+	metadata.Padding = NoPadding{}.String()
+	if ec.Padding != nil {
+		metadata.Padding = ec.Padding.String()
+		src = pad(src, ec.Padding)
+	}
+
 	if utils.Shards+utils.Pairty > 256 {
 		return errors.New("sum of shard & pairty cannot be > 256")
 	}
@@ -119,7 +132,11 @@ func (ErasureCodec) Decode(metadata *storage.Metadata) (outfile string, err erro
 		return
 	}
 
-	err = enc.Join(f, shards, len(shards[0])*utils.Shards)
+	defer f.Close()
+
+	// only the true length is written back, dropping both our padding and
+	// the zero fill added by Split
+	err = enc.Join(f, shards, int(metadata.Size))
 	if err != nil {
 		return
 	}
@@ -0,0 +1,79 @@
+package codec
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// PaddingPolicy decides how many bytes a payload occupies once padded, so
+// storage peers only ever see a handful of distinct sizes.
+type PaddingPolicy interface {
+	PaddedSize(size int) int
+	String() string
+}
+
+type NoPadding struct{}
+
+func (NoPadding) PaddedSize(size int) int { return size }
+func (NoPadding) String() string          { return "none" }
+
+// PowerOfTwoPadding rounds every payload up to the next power of two.
+type PowerOfTwoPadding struct{}
+
+func (PowerOfTwoPadding) PaddedSize(size int) int {
+	if size <= 1 {
+		return 1
+	}
+	return 1 << bits.Len(uint(size-1))
+}
+
+func (PowerOfTwoPadding) String() string { return "pow2" }
+
+// BucketPadding rounds every payload up to a multiple of Size.
+type BucketPadding struct {
+	Size int
+}
+
+func (b BucketPadding) PaddedSize(size int) int {
+	if b.Size <= 0 || size <= 0 {
+		return b.Size
+	}
+	return ((size + b.Size - 1) / b.Size) * b.Size
+}
+
+func (b BucketPadding) String() string { return fmt.Sprintf("bucket:%d", b.Size) }
+
+// ParsePaddingPolicy accepts "none", "pow2" or "bucket:<bytes>".
+func ParsePaddingPolicy(s string) (PaddingPolicy, error) {
+	switch {
+	case s == "" || s == "none":
+		return NoPadding{}, nil
+	case s == "pow2":
+		return PowerOfTwoPadding{}, nil
+	case strings.HasPrefix(s, "bucket:"):
+		size, err := strconv.Atoi(strings.TrimPrefix(s, "bucket:"))
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("invalid bucket size: %s", s)
+		}
+		return BucketPadding{Size: size}, nil
+	default:
+		return nil, fmt.Errorf("unknown padding policy: %s", s)
+	}
+}
+
+func pad(src []byte, policy PaddingPolicy) []byte {
+	if policy == nil {
+		return src
+	}
+
+	size := policy.PaddedSize(len(src))
+	if size <= len(src) {
+		return src
+	}
+
+	padded := make([]byte, size)
+	copy(padded, src)
+	return padded
+}
@@ -1,7 +1,9 @@
 package hashing
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"fmt"
 	"io"
 	"os"
 
@@ -34,3 +36,67 @@ func HashFile(path string) (string, error) {
 
 	return c.String(), nil
 }
+
+// TrimPadding truncates the file at path to the length whose hash is the
+// CID id, dropping the zeros a padded transfer appended to the content. The
+// content may itself end in zeros, each length past its last other byte is
+// tried in turn.
+func TrimPadding(path, id string) error {
+	c, err := cid.Decode(id)
+	if err != nil {
+		return fmt.Errorf("invalid CID: %q", id)
+	}
+	decoded, err := multihash.Decode(c.Hash())
+	if err != nil || decoded.Code != multihash.SHA2_256 {
+		return fmt.Errorf("unsupported hash of CID: %s", id)
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	end, err := contentEnd(file, info.Size())
+	if err != nil {
+		return err
+	}
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, io.NewSectionReader(file, 0, end)); err != nil {
+		return err
+	}
+	for length := end; length <= info.Size(); length++ {
+		if length > end {
+			hasher.Write([]byte{0})
+		}
+		if bytes.Equal(hasher.Sum(nil), decoded.Digest) {
+			return file.Truncate(length)
+		}
+	}
+	return fmt.Errorf("content does not match CID: %s", id)
+}
+
+// contentEnd returns the length of file up to its last byte that is not
+// zero.
+func contentEnd(file *os.File, size int64) (int64, error) {
+	buf := make([]byte, 32<<10)
+	for end := size; end > 0; {
+		start := max(end-int64(len(buf)), 0)
+		chunk := buf[:end-start]
+		if _, err := file.ReadAt(chunk, start); err != nil {
+			return 0, err
+		}
+		for i := len(chunk) - 1; i >= 0; i-- {
+			if chunk[i] != 0 {
+				return start + int64(i) + 1, nil
+			}
+		}
+		end = start
+	}
+	return 0, nil
+}
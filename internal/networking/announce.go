@@ -0,0 +1,123 @@
+package networking
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/gokul656/obscure-fs/utils"
+	"github.com/libp2p/go-libp2p/core/peer"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// StartNodeAnnouncements publishes this node on the nodes topic every
+// interval and registers the announcements of other nodes, so the registry
+// fills itself in on any topology. The registry comes from WithRegistry.
+func (n *Network) StartNodeAnnouncements(ctx context.Context, apiScheme string, apiPort int, interval time.Duration) error {
+	if n.registry == nil {
+		return fmt.Errorf("no node registry configured")
+	}
+	topic, err := n.joinTopic(utils.NodesTopic)
+	if err != nil {
+		return err
+	}
+
+	sub, err := topic.Subscribe()
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			msg, err := sub.Next(ctx)
+			if err != nil {
+				return
+			}
+			if msg.ReceivedFrom == n.host.ID() {
+				continue
+			}
+
+			var reg SignedRegistration
+			if err := json.Unmarshal(msg.Data, &reg); err != nil {
+				log.Printf("malformed node announcement from peer: %s\n", msg.ReceivedFrom)
+				continue
+			}
+
+			// pubsub signs messages with the author key, it must be the node itself
+			if err := reg.Verify(); err != nil || reg.Node.ID != msg.GetFrom().String() {
+				log.Printf("rejected node announcement from peer: %s, error: %v\n", msg.GetFrom(), err)
+				continue
+			}
+
+			n.registry.RegisterNode(reg.Node)
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := n.announceNode(ctx, apiScheme, apiPort); err != nil {
+				log.Printf("failed to announce node: %v\n", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (n *Network) announceNode(ctx context.Context, apiScheme string, apiPort int) error {
+	topic, err := n.joinTopic(utils.NodesTopic)
+	if err != nil {
+		return err
+	}
+
+	reg, err := SignRegistration(n.host.Peerstore().PrivKey(n.host.ID()), n.Self(apiScheme, apiPort))
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(reg)
+	if err != nil {
+		return err
+	}
+	return topic.Publish(ctx, data)
+}
+
+// Self describes this node with the addresses the host actually listens on.
+func (n *Network) Self(apiScheme string, apiPort int) Node {
+	info := peer.AddrInfo{ID: n.host.ID(), Addrs: n.host.Addrs()}
+	p2pAddrs, _ := peer.AddrInfoToP2pAddrs(&info)
+
+	self := n.selfCandidate()
+	node := Node{ID: self.ID, Zone: self.Zone, Role: n.profile.Role, Capacity: self.Capacity, Free: self.Free}
+	for _, addr := range p2pAddrs {
+		node.Addresses = append(node.Addresses, addr.String())
+	}
+
+	for _, addr := range n.host.Addrs() {
+		ip, err := manet.ToIP(addr)
+		if err != nil {
+			continue
+		}
+
+		endpoint := fmt.Sprintf("%s://%s:%d", apiScheme, ip, apiPort)
+		if ip.To4() == nil {
+			endpoint = fmt.Sprintf("%s://[%s]:%d", apiScheme, ip, apiPort)
+		}
+		if !slices.Contains(node.APIEndpoints, endpoint) {
+			node.APIEndpoints = append(node.APIEndpoints, endpoint)
+		}
+	}
+	return node
+}
@@ -0,0 +1,136 @@
+package networking
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gokul656/obscure-fs/internal/search"
+)
+
+// CatalogEntry is a file seen on the network and the peers providing it.
+type CatalogEntry struct {
+	search.Document
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type catalogItem struct {
+	file      search.Document
+	providers map[string]time.Time
+}
+
+// Catalog is the network file listing, kept up to date from file
+// announcements instead of asking every peer on each request.
+type Catalog struct {
+	mu      sync.RWMutex
+	entries map[string]*catalogItem
+	index   *search.Index
+}
+
+func NewCatalog() *Catalog {
+	return &Catalog{
+		entries: make(map[string]*catalogItem),
+		index:   search.NewIndex(),
+	}
+}
+
+func (c *Catalog) Add(file search.Document, provider string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, ok := c.entries[file.CID]
+	if !ok {
+		item = &catalogItem{providers: make(map[string]time.Time)}
+		c.entries[file.CID] = item
+	}
+	item.file = file
+	item.providers[provider] = time.Now()
+	c.index.Put(item.entry().Document)
+}
+
+func (c *Catalog) Remove(cid, provider string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeLocked(cid, provider)
+}
+
+// RemoveProvider drops every entry announced by provider.
+func (c *Catalog) RemoveProvider(provider string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for cid := range c.entries {
+		c.removeLocked(cid, provider)
+	}
+}
+
+func (c *Catalog) removeLocked(cid, provider string) {
+	item, ok := c.entries[cid]
+	if !ok {
+		return
+	}
+
+	delete(item.providers, provider)
+	if len(item.providers) == 0 {
+		delete(c.entries, cid)
+		c.index.Delete(cid)
+		return
+	}
+	c.index.Put(item.entry().Document)
+}
+
+func (c *Catalog) Get(cid string) (CatalogEntry, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	item, ok := c.entries[cid]
+	if !ok {
+		return CatalogEntry{}, false
+	}
+	return item.entry(), true
+}
+
+// Search looks up network files, each result lists its providers.
+func (c *Catalog) Search(q search.Query) []search.Document {
+	return c.index.Search(q)
+}
+
+// List returns a page of entries ordered by CID along with the total count.
+func (c *Catalog) List(offset, limit int) ([]CatalogEntry, int) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	cids := make([]string, 0, len(c.entries))
+	for cid := range c.entries {
+		cids = append(cids, cid)
+	}
+	sort.Strings(cids)
+
+	total := len(cids)
+	if offset > total {
+		offset = total
+	}
+	end := total
+	if limit > 0 && offset+limit < total {
+		end = offset + limit
+	}
+
+	page := make([]CatalogEntry, 0, end-offset)
+	for _, cid := range cids[offset:end] {
+		page = append(page, c.entries[cid].entry())
+	}
+	return page, total
+}
+
+func (item *catalogItem) entry() CatalogEntry {
+	entry := CatalogEntry{Document: item.file}
+	entry.Providers = make([]string, 0, len(item.providers))
+	for p, updated := range item.providers {
+		entry.Providers = append(entry.Providers, p)
+		if updated.After(entry.UpdatedAt) {
+			entry.UpdatedAt = updated
+		}
+	}
+	sort.Strings(entry.Providers)
+	return entry
+}
@@ -0,0 +1,175 @@
+package networking
+
+import (
+	"context"
+	"log"
+	"os"
+)
+
+// Fetch opens the content of cid, the caller closes the file. Files stored
+// on this node are read in place, anything else goes through the cache, and
+// concurrent fetches of a CID share one retrieval. Cached content is opened
+// under the cache lock, the handle stays readable if it is evicted while it
+// is being served.
+//
+// Content fetched with a token is only meant for its holder, so it skips the
+// cache and lands in a temporary file the caller has to remove.
+//
+// A caller whose ctx is done stops waiting, a shared retrieval carries on
+// into the cache for the other callers and is cancelled once none is left.
+func (n *Network) Fetch(ctx context.Context, cid, token string) (f *os.File, temporary bool, err error) {
+	if path, err := n.fileStore.GetFile(cid); err == nil {
+		f, err := os.Open(path)
+		return f, false, err
+	}
+
+	if token != "" {
+		tmp, err := os.CreateTemp("", "obscure-fs-*")
+		if err != nil {
+			return nil, false, err
+		}
+		tmp.Close()
+
+		if err := n.RetrieveFile(ctx, cid, tmp.Name(), token); err != nil {
+			os.Remove(tmp.Name())
+			return nil, false, err
+		}
+		f, err := os.Open(tmp.Name())
+		if err != nil {
+			os.Remove(tmp.Name())
+			return nil, false, err
+		}
+		return f, true, nil
+	}
+
+	for {
+		if f, ok := n.cache.Open(cid); ok {
+			return f, false, nil
+		}
+		// a copy evicted before it could be opened is fetched again
+		if err := n.awaitFetch(ctx, cid); err != nil {
+			return nil, false, err
+		}
+	}
+}
+
+// sharedFetch is a retrieval into the cache that concurrent fetches of a
+// CID wait on together. Its outcome is set once done is closed.
+type sharedFetch struct {
+	done    chan struct{}
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// awaitFetch waits until cid is retrieved into the cache, sharing the
+// retrieval in flight if there is one.
+func (n *Network) awaitFetch(ctx context.Context, cid string) error {
+	fetch, err := n.joinFetch(ctx, cid)
+	if err != nil {
+		return err
+	}
+	defer n.leaveFetch(fetch)
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-fetch.done:
+		return fetch.err
+	}
+}
+
+// joinFetch waits on the retrieval of cid in flight, or starts one. A
+// retrieval every waiter left is still winding down, it is let finish
+// before the next one writes to the same partial file.
+func (n *Network) joinFetch(ctx context.Context, cid string) (*sharedFetch, error) {
+	for {
+		n.fetchesMu.Lock()
+		fetch, ok := n.fetches[cid]
+		if !ok {
+			fetchCtx, cancel := context.WithCancel(n.ctx)
+			fetch = &sharedFetch{done: make(chan struct{}), waiters: 1, cancel: cancel}
+			n.fetches[cid] = fetch
+			n.fetchesMu.Unlock()
+
+			go func() {
+				fetch.err = n.fetchToCache(fetchCtx, cid)
+				cancel()
+
+				n.fetchesMu.Lock()
+				delete(n.fetches, cid)
+				n.fetchesMu.Unlock()
+				close(fetch.done)
+			}()
+			return fetch, nil
+		}
+		if fetch.waiters > 0 {
+			fetch.waiters++
+			n.fetchesMu.Unlock()
+			return fetch, nil
+		}
+		n.fetchesMu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-fetch.done:
+		}
+	}
+}
+
+// leaveFetch stops waiting on fetch, the last waiter to leave cancels it.
+func (n *Network) leaveFetch(fetch *sharedFetch) {
+	n.fetchesMu.Lock()
+	defer n.fetchesMu.Unlock()
+
+	fetch.waiters--
+	if fetch.waiters == 0 {
+		fetch.cancel()
+	}
+}
+
+// fetchToCache retrieves cid into the cache.
+func (n *Network) fetchToCache(ctx context.Context, cid string) error {
+	if err := n.RetrieveFile(ctx, cid, n.cache.PartialPath(cid), ""); err != nil {
+		os.Remove(n.cache.PartialPath(cid))
+		return err
+	}
+	if err := n.cache.Add(cid); err != nil {
+		return err
+	}
+
+	if n.reprovide {
+		n.reprovideCached(cid)
+	}
+	return nil
+}
+
+// reprovideCached advertises cached content on the DHT. Only files the
+// catalog lists as public qualify, content this node was let to read as an
+// authorized peer is never handed on.
+func (n *Network) reprovideCached(cid string) {
+	if _, ok := n.catalog.Get(cid); !ok {
+		return
+	}
+	if err := n.AnnounceFile(n.ctx, cid); err != nil {
+		log.Printf("failed to reprovide cached CID: %s, error: %v\n", cid, err)
+		return
+	}
+	log.Printf("reproviding cached CID: %s\n", cid)
+}
+
+// cachedForPeers returns the cached copy of cid when it may be served to
+// other peers, with the size the catalog lists it at, padded when the file
+// is.
+func (n *Network) cachedForPeers(cid string) (string, int64, bool) {
+	if !n.reprovide {
+		return "", 0, false
+	}
+	file, ok := n.catalog.Get(cid)
+	if !ok {
+		return "", 0, false
+	}
+	path, ok := n.cache.Get(cid)
+	return path, file.Size, ok
+}
@@ -0,0 +1,192 @@
+package networking
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/gokul656/obscure-fs/internal/search"
+	"github.com/gokul656/obscure-fs/internal/storage"
+	"github.com/gokul656/obscure-fs/utils"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	FileAdded   = "add"
+	FileRemoved = "remove"
+
+	// maxListSize caps the file listing read from a peer.
+	maxListSize = 16 << 20
+)
+
+// FileAnnouncement tells the network that Provider started or stopped
+// providing a public file. Removals only carry the CID.
+type FileAnnouncement struct {
+	Action   string          `json:"action"`
+	File     search.Document `json:"file"`
+	Provider string          `json:"provider"`
+}
+
+func (n *Network) Catalog() *Catalog {
+	return n.catalog
+}
+
+// StartFileAnnouncements keeps the catalog in sync with the files topic. A
+// peer joining the topic is asked for its public files once, later changes
+// arrive as announcements.
+func (n *Network) StartFileAnnouncements(ctx context.Context) error {
+	topic, err := n.joinTopic(utils.FilesTopic)
+	if err != nil {
+		return err
+	}
+
+	sub, err := topic.Subscribe()
+	if err != nil {
+		return err
+	}
+
+	events, err := topic.EventHandler()
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			msg, err := sub.Next(ctx)
+			if err != nil {
+				return
+			}
+			if msg.ReceivedFrom == n.host.ID() {
+				continue
+			}
+
+			var announcement FileAnnouncement
+			if err := json.Unmarshal(msg.Data, &announcement); err != nil {
+				log.Printf("malformed file announcement from peer: %s\n", msg.ReceivedFrom)
+				continue
+			}
+
+			// peers may only announce their own files
+			if announcement.Provider != msg.GetFrom().String() {
+				log.Printf("rejected file announcement from peer: %s for provider: %s\n", msg.GetFrom(), announcement.Provider)
+				continue
+			}
+
+			switch announcement.Action {
+			case FileAdded:
+				n.catalog.Add(announcement.File, announcement.Provider)
+			case FileRemoved:
+				n.catalog.Remove(announcement.File.CID, announcement.Provider)
+			}
+		}
+	}()
+
+	go func() {
+		for {
+			event, err := events.NextPeerEvent(ctx)
+			if err != nil {
+				return
+			}
+
+			switch event.Type {
+			case pubsub.PeerJoin:
+				go n.seedCatalog(ctx, event.Peer)
+			case pubsub.PeerLeave:
+				n.catalog.RemoveProvider(event.Peer.String())
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (n *Network) seedCatalog(ctx context.Context, id peer.ID) {
+	files, err := n.ListPeerFiles(ctx, id)
+	if err != nil {
+		log.Printf("failed to list files of peer: %s, error: %v\n", id, err)
+		return
+	}
+
+	for _, file := range files {
+		n.catalog.Add(file, id.String())
+	}
+}
+
+// ListPeerFiles asks a peer for its public files over the list_files command.
+// Listings longer than maxListSize are refused.
+func (n *Network) ListPeerFiles(ctx context.Context, id peer.ID) ([]search.Document, error) {
+	ctx, cancel := withTimeout(ctx, n.timeouts.Request)
+	defer cancel()
+
+	stream, err := n.host.NewStream(ctx, id, utils.ProtocolID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stream: %w", err)
+	}
+	defer stream.Close()
+	defer bindStream(ctx, stream)()
+
+	if _, err := stream.Write([]byte("list_files\n")); err != nil {
+		return nil, fmt.Errorf("failed to request files: %w", err)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(stream, maxListSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read files: %w", streamErr(ctx, err))
+	}
+	if len(data) > maxListSize {
+		return nil, fmt.Errorf("file listing exceeds %d bytes", maxListSize)
+	}
+
+	var files []search.Document
+	if err := json.Unmarshal(data, &files); err != nil {
+		return nil, fmt.Errorf("failed to decode files: %w", err)
+	}
+	return files, nil
+}
+
+// announceFile publishes a file event, it is a no-op until the files topic
+// has been joined.
+func (n *Network) announceFile(action string, file search.Document) {
+	n.topicsMu.Lock()
+	topic, ok := n.topics[utils.FilesTopic]
+	n.topicsMu.Unlock()
+	if !ok {
+		return
+	}
+
+	data, err := json.Marshal(FileAnnouncement{Action: action, File: file, Provider: n.host.ID().String()})
+	if err != nil {
+		return
+	}
+	if err := topic.Publish(n.ctx, data); err != nil {
+		log.Printf("failed to announce file: %s, error: %v\n", file.CID, err)
+	}
+}
+
+// SetVisibility changes the visibility of a stored file and tells the
+// network when it enters or leaves the public listing.
+func (n *Network) SetVisibility(ctx context.Context, cid string, visibility storage.Visibility) error {
+	entry, err := n.fileStore.GetEntry(cid)
+	if err != nil {
+		return err
+	}
+
+	if err := n.fileStore.SetVisibility(cid, visibility); err != nil {
+		return err
+	}
+
+	switch {
+	case entry.Visibility != storage.Public && visibility == storage.Public:
+		n.announceFile(FileAdded, entry.Document(cid))
+	case entry.Visibility == storage.Public && visibility != storage.Public:
+		n.announceFile(FileRemoved, search.Document{CID: cid})
+	}
+
+	if entry.Visibility == storage.Private && visibility != storage.Private {
+		return n.AnnounceFile(ctx, cid)
+	}
+	return nil
+}
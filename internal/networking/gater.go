@@ -0,0 +1,211 @@
+package networking
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/gokul656/obscure-fs/utils"
+	"github.com/libp2p/go-libp2p/core/control"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+const (
+	AllowList = "allow"
+	DenyList  = "deny"
+)
+
+// GaterRules holds peer IDs and multiaddrs. An address rule matches any
+// address it is a prefix of, so /ip4/10.0.0.1 covers every port on that host.
+type GaterRules struct {
+	Peers []string `json:"peers"`
+	Addrs []string `json:"addrs"`
+}
+
+func (r GaterRules) empty() bool {
+	return len(r.Peers) == 0 && len(r.Addrs) == 0
+}
+
+func (r GaterRules) hasPeer(id peer.ID) bool {
+	return slices.Contains(r.Peers, id.String())
+}
+
+func (r GaterRules) hasAddr(addr multiaddr.Multiaddr) bool {
+	if addr == nil {
+		return false
+	}
+
+	s := addr.String()
+	for _, rule := range r.Addrs {
+		if s == rule || strings.HasPrefix(s, rule+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Gater is a connection gater driven by persisted allow and deny lists.
+// Deny rules always win, and once any allow rule exists only peers matching
+// one of them are let through.
+type Gater struct {
+	mu    sync.RWMutex
+	path  string
+	allow GaterRules
+	deny  GaterRules
+}
+
+func NewGater(path string) (*Gater, error) {
+	g := &Gater{path: path}
+
+	var rules map[string]GaterRules
+	if err := utils.ReadJSONFile(path, &rules); err != nil {
+		return nil, fmt.Errorf("failed to load gater rules: %w", err)
+	}
+	g.allow = rules[AllowList]
+	g.deny = rules[DenyList]
+	return g, nil
+}
+
+func (g *Gater) Rules() map[string]GaterRules {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return map[string]GaterRules{
+		AllowList: {Peers: slices.Clone(g.allow.Peers), Addrs: slices.Clone(g.allow.Addrs)},
+		DenyList:  {Peers: slices.Clone(g.deny.Peers), Addrs: slices.Clone(g.deny.Addrs)},
+	}
+}
+
+func (g *Gater) Add(list string, rules GaterRules) error {
+	if err := validateRules(rules); err != nil {
+		return err
+	}
+
+	return g.update(list, func(target *GaterRules) {
+		for _, p := range rules.Peers {
+			if !slices.Contains(target.Peers, p) {
+				target.Peers = append(target.Peers, p)
+			}
+		}
+		for _, a := range rules.Addrs {
+			if !slices.Contains(target.Addrs, a) {
+				target.Addrs = append(target.Addrs, a)
+			}
+		}
+	})
+}
+
+func (g *Gater) Remove(list string, rules GaterRules) error {
+	return g.update(list, func(target *GaterRules) {
+		target.Peers = slices.DeleteFunc(target.Peers, func(p string) bool { return slices.Contains(rules.Peers, p) })
+		target.Addrs = slices.DeleteFunc(target.Addrs, func(a string) bool { return slices.Contains(rules.Addrs, a) })
+	})
+}
+
+// update applies change to a copy of the named list, the list is only
+// replaced once the rules with the change are saved.
+func (g *Gater) update(name string, change func(*GaterRules)) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	target, err := g.list(name)
+	if err != nil {
+		return err
+	}
+
+	old := *target
+	updated := GaterRules{Peers: slices.Clone(old.Peers), Addrs: slices.Clone(old.Addrs)}
+	change(&updated)
+
+	*target = updated
+	if err := g.save(); err != nil {
+		*target = old
+		return err
+	}
+	return nil
+}
+
+func (g *Gater) list(name string) (*GaterRules, error) {
+	switch name {
+	case AllowList:
+		return &g.allow, nil
+	case DenyList:
+		return &g.deny, nil
+	default:
+		return nil, fmt.Errorf("unknown gater list: %s", name)
+	}
+}
+
+func (g *Gater) save() error {
+	return utils.WriteJSONFile(g.path, map[string]GaterRules{AllowList: g.allow, DenyList: g.deny})
+}
+
+func validateRules(rules GaterRules) error {
+	for _, p := range rules.Peers {
+		if _, err := peer.Decode(p); err != nil {
+			return fmt.Errorf("invalid peer ID %s: %w", p, err)
+		}
+	}
+	for _, a := range rules.Addrs {
+		if _, err := multiaddr.NewMultiaddr(a); err != nil {
+			return fmt.Errorf("invalid multiaddr %s: %w", a, err)
+		}
+	}
+	return nil
+}
+
+// Allowed reports whether a peer reached at addr passes the lists. Either
+// may be empty when it is not known yet, the deny list is checked against
+// the known half but the allow list only once both are known, since a peer
+// may be allowed by the half that is missing.
+func (g *Gater) Allowed(id peer.ID, addr multiaddr.Multiaddr) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if (id != "" && g.deny.hasPeer(id)) || g.deny.hasAddr(addr) {
+		return false
+	}
+	if g.allow.empty() || id == "" || addr == nil {
+		return true
+	}
+	return g.allow.hasPeer(id) || g.allow.hasAddr(addr)
+}
+
+func (g *Gater) InterceptPeerDial(id peer.ID) bool {
+	if !g.Allowed(id, nil) {
+		log.Printf("gater: rejected dial to peer: %s\n", id)
+		return false
+	}
+	return true
+}
+
+func (g *Gater) InterceptAddrDial(id peer.ID, addr multiaddr.Multiaddr) bool {
+	if !g.Allowed(id, addr) {
+		log.Printf("gater: rejected dial to peer: %s at: %s\n", id, addr)
+		return false
+	}
+	return true
+}
+
+func (g *Gater) InterceptAccept(addrs network.ConnMultiaddrs) bool {
+	if !g.Allowed("", addrs.RemoteMultiaddr()) {
+		log.Printf("gater: rejected inbound connection from: %s\n", addrs.RemoteMultiaddr())
+		return false
+	}
+	return true
+}
+
+func (g *Gater) InterceptSecured(dir network.Direction, id peer.ID, addrs network.ConnMultiaddrs) bool {
+	if !g.Allowed(id, addrs.RemoteMultiaddr()) {
+		log.Printf("gater: rejected %s connection with peer: %s at: %s\n", dir, id, addrs.RemoteMultiaddr())
+		return false
+	}
+	return true
+}
+
+func (g *Gater) InterceptUpgraded(network.Conn) (bool, control.DisconnectReason) {
+	return true, 0
+}
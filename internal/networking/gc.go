@@ -0,0 +1,69 @@
+package networking
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/gokul656/obscure-fs/internal/search"
+	"github.com/gokul656/obscure-fs/internal/storage"
+)
+
+// DeleteFile removes cid from the store and stops providing it. Public files
+// are withdrawn from the network catalog right away; DHT provider records
+// cannot be revoked and expire since they are no longer refreshed.
+func (n *Network) DeleteFile(cid string) (storage.GCResult, error) {
+	_, result, err := n.fileStore.Delete(cid)
+	if err != nil {
+		return result, err
+	}
+
+	n.withdraw(result)
+	log.Printf("file deleted: %s\n", cid)
+	return result, nil
+}
+
+// tempFileGrace keeps retrieval copies that may still be being served.
+const tempFileGrace = 10 * time.Minute
+
+// CollectGarbage drops files pinned neither locally nor in the cluster pin
+// set and reclaims their storage, along with cached retrievals not read
+// within tempFileGrace.
+func (n *Network) CollectGarbage() storage.GCResult {
+	var retain func(string) bool
+	if n.pins != nil {
+		retain = n.pins.IsPinned
+	}
+	result := n.fileStore.CollectGarbage(retain)
+	n.withdraw(result)
+
+	files, bytes := n.cache.Prune(tempFileGrace)
+	result.FilesReclaimed += files
+	result.BytesReclaimed += bytes
+
+	log.Printf("garbage collection removed %d files, reclaimed %d bytes\n", len(result.Removed), result.BytesReclaimed)
+	return result
+}
+
+// StartGarbageCollector runs CollectGarbage every interval.
+func (n *Network) StartGarbageCollector(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n.CollectGarbage()
+		}
+	}
+}
+
+func (n *Network) withdraw(result storage.GCResult) {
+	for cid, entry := range result.Entries {
+		if entry.Visibility == storage.Public {
+			n.announceFile(FileRemoved, search.Document{CID: cid})
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package networking
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// healthDecay weighs a new latency or throughput sample against the average
+// of the ones before it.
+const healthDecay = 0.3
+
+// healthTransfer is the transfer size peers are scored on, their throughput
+// counts as much as their latency for a transfer of that size.
+const healthTransfer = 1 << 20
+
+// Circuit states, an open circuit skips the peer until its cooldown ends and
+// a half-open one lets a single attempt through to probe it.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// errNotServed is a peer answering that it will not serve a request, which
+// says nothing about its health.
+var errNotServed = errors.New("peer refused or does not hold the file")
+
+// HealthPolicy sets how requests to peers are retried and when a peer's
+// circuit opens.
+type HealthPolicy struct {
+	// Retries is how many more rounds over the providers are made after
+	// the first one failed, each after an exponential backoff.
+	Retries     int           `json:"retries"`
+	BaseBackoff time.Duration `json:"base_backoff"`
+	MaxBackoff  time.Duration `json:"max_backoff"`
+	// FailureThreshold consecutive failures open a circuit for Cooldown.
+	FailureThreshold int           `json:"failure_threshold"`
+	Cooldown         time.Duration `json:"cooldown"`
+}
+
+var DefaultHealthPolicy = HealthPolicy{
+	Retries:          2,
+	BaseBackoff:      500 * time.Millisecond,
+	MaxBackoff:       10 * time.Second,
+	FailureThreshold: 3,
+	Cooldown:         time.Minute,
+}
+
+// Backoff returns how long to wait before retry attempt, counted from 0,
+// with up to a quarter of jitter.
+func (p HealthPolicy) Backoff(attempt int) time.Duration {
+	backoff := p.BaseBackoff << min(attempt, 30)
+	if backoff <= 0 || backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return backoff - time.Duration(rand.Int64N(int64(backoff)/4+1))
+}
+
+// PeerHealth is what the node observed of a peer's requests.
+type PeerHealth struct {
+	Peer                string        `json:"peer"`
+	Successes           int           `json:"successes"`
+	Failures            int           `json:"failures"`
+	ConsecutiveFailures int           `json:"consecutive_failures"`
+	Latency             time.Duration `json:"latency"`
+	// Throughput is in bytes per second.
+	Throughput  float64   `json:"throughput"`
+	LastSuccess time.Time `json:"last_success,omitempty"`
+	LastFailure time.Time `json:"last_failure,omitempty"`
+	LastError   string    `json:"last_error,omitempty"`
+	Circuit     string    `json:"circuit"`
+	OpenUntil   time.Time `json:"open_until,omitempty"`
+	Score       float64   `json:"score"`
+
+	probing bool
+}
+
+// score favours peers that succeed and would move healthTransfer bytes
+// fast, counting both the round trip and the throughput. Peers never tried
+// score as a coin flip with a second of latency and a second per
+// healthTransfer bytes.
+func (h *PeerHealth) score() float64 {
+	latency := time.Second
+	if h.Latency > 0 {
+		latency = h.Latency
+	}
+	transfer := 1.0
+	if h.Throughput > 0 {
+		transfer = healthTransfer / h.Throughput
+	}
+	rate := float64(h.Successes+1) / float64(h.Successes+h.Failures+2)
+	return rate / (1 + latency.Seconds() + transfer)
+}
+
+func (h *PeerHealth) circuit(now time.Time) string {
+	switch {
+	case h.OpenUntil.IsZero():
+		return CircuitClosed
+	case now.Before(h.OpenUntil):
+		return CircuitOpen
+	default:
+		return CircuitHalfOpen
+	}
+}
+
+// HealthTracker scores peers by the outcome of the requests made to them
+// and breaks the circuit of peers that keep failing.
+type HealthTracker struct {
+	mu     sync.Mutex
+	policy HealthPolicy
+	peers  map[peer.ID]*PeerHealth
+}
+
+func NewHealthTracker(policy HealthPolicy) *HealthTracker {
+	return &HealthTracker{policy: policy, peers: make(map[peer.ID]*PeerHealth)}
+}
+
+func (t *HealthTracker) Policy() HealthPolicy {
+	return t.policy
+}
+
+// getLocked must be called with the lock held.
+func (t *HealthTracker) getLocked(id peer.ID) *PeerHealth {
+	h, ok := t.peers[id]
+	if !ok {
+		h = &PeerHealth{Peer: id.String()}
+		t.peers[id] = h
+	}
+	return h
+}
+
+// Record adds the outcome of a request to id that moved bytes in took.
+// Refusals are answers, they count as neither success nor failure.
+func (t *HealthTracker) Record(id peer.ID, took time.Duration, bytes int64, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h := t.getLocked(id)
+	now := time.Now()
+	h.probing = false
+	if errors.Is(err, errNotServed) {
+		return
+	}
+
+	if err != nil {
+		h.Failures++
+		h.ConsecutiveFailures++
+		h.LastFailure = now
+		h.LastError = err.Error()
+		if h.circuit(now) == CircuitHalfOpen || h.ConsecutiveFailures >= t.policy.FailureThreshold {
+			if h.circuit(now) != CircuitOpen {
+				log.Printf("circuit opened for peer: %s after %d failures\n", id, h.ConsecutiveFailures)
+			}
+			h.OpenUntil = now.Add(t.policy.Cooldown)
+		}
+		return
+	}
+
+	if !h.OpenUntil.IsZero() {
+		log.Printf("circuit closed for peer: %s\n", id)
+	}
+	h.Successes++
+	h.ConsecutiveFailures = 0
+	h.LastSuccess = now
+	h.OpenUntil = time.Time{}
+	if bytes > 0 && took > 0 {
+		sample := float64(bytes) / took.Seconds()
+		if h.Throughput == 0 {
+			h.Throughput = sample
+		} else {
+			h.Throughput += healthDecay * (sample - h.Throughput)
+		}
+	}
+}
+
+// Abandon ends a request to id that the caller gave up on, it counts as
+// neither success nor failure.
+func (t *HealthTracker) Abandon(id peer.ID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if h, ok := t.peers[id]; ok {
+		h.probing = false
+	}
+}
+
+// RecordLatency adds a round trip measured to id.
+func (t *HealthTracker) RecordLatency(id peer.ID, rtt time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h := t.getLocked(id)
+	if h.Latency == 0 {
+		h.Latency = rtt
+		return
+	}
+	h.Latency += time.Duration(healthDecay * float64(rtt-h.Latency))
+}
+
+// Allow reports whether a request may go to id now. A half-open circuit
+// lets one request through at a time.
+func (t *HealthTracker) Allow(id peer.ID) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h, ok := t.peers[id]
+	if !ok {
+		return true
+	}
+	switch h.circuit(time.Now()) {
+	case CircuitOpen:
+		return false
+	case CircuitHalfOpen:
+		if h.probing {
+			return false
+		}
+		h.probing = true
+	}
+	return true
+}
+
+// Rank orders ids by score, best first, and leaves out the ones whose
+// circuit is open.
+func (t *HealthTracker) Rank(ids []peer.ID) []peer.ID {
+	t.mu.Lock()
+	now := time.Now()
+	ranked := make([]peer.ID, 0, len(ids))
+	scores := make(map[peer.ID]float64, len(ids))
+	for _, id := range ids {
+		h := t.getLocked(id)
+		if h.circuit(now) == CircuitOpen {
+			continue
+		}
+		scores[id] = h.score()
+		ranked = append(ranked, id)
+	}
+	t.mu.Unlock()
+
+	sort.SliceStable(ranked, func(i, j int) bool { return scores[ranked[i]] > scores[ranked[j]] })
+	return ranked
+}
+
+// Peers returns the health of every peer requests were made to, best
+// scoring first.
+func (t *HealthTracker) Peers() []PeerHealth {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	peers := make([]PeerHealth, 0, len(t.peers))
+	for _, h := range t.peers {
+		snapshot := *h
+		snapshot.Circuit = h.circuit(now)
+		snapshot.Score = h.score()
+		peers = append(peers, snapshot)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Score > peers[j].Score })
+	return peers
+}
+
+func (n *Network) Health() *HealthTracker {
+	return n.health
+}
+
+// tryPeers runs op against ids in score order until it succeeds. When every
+// peer failed, it waits an exponential backoff and tries again, up to the
+// retries of the health policy. Peers that refused are not asked again,
+// peers with an open circuit are skipped. Once ctx is done it returns its
+// error, and the request in flight is not held against the peer.
+func (n *Network) tryPeers(ctx context.Context, ids []peer.ID, op func(peer.ID) (int64, error)) error {
+	refused := make(map[peer.ID]bool)
+	var lastErr error
+	for attempt := 0; attempt <= n.health.policy.Retries; attempt++ {
+		if attempt > 0 {
+			backoff := n.health.policy.Backoff(attempt - 1)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+		}
+
+		tried := 0
+		for _, id := range n.health.Rank(ids) {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if refused[id] || !n.health.Allow(id) {
+				continue
+			}
+			tried++
+
+			started := time.Now()
+			bytes, err := op(id)
+			if err != nil && ctx.Err() != nil {
+				n.health.Abandon(id)
+				return ctx.Err()
+			}
+			n.health.Record(id, time.Since(started), bytes, err)
+			if err == nil {
+				return nil
+			}
+			if errors.Is(err, errNotServed) {
+				refused[id] = true
+			}
+			lastErr = err
+		}
+		if tried == 0 {
+			break
+		}
+	}
+
+	if lastErr == nil {
+		return fmt.Errorf("no provider available")
+	}
+	return lastErr
+}
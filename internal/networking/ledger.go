@@ -0,0 +1,236 @@
+package networking
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gokul656/obscure-fs/utils"
+	"github.com/libp2p/go-libp2p/core/metrics"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// LedgerEntry totals the bytes exchanged with a peer across restarts. The
+// traffic of the protocols in unledgered is not counted.
+type LedgerEntry struct {
+	Peer     string `json:"peer"`
+	Sent     int64  `json:"sent"`
+	Received int64  `json:"received"`
+	// RateOut and RateIn are the current bytes per second, they are not
+	// persisted.
+	RateOut      float64   `json:"rate_out"`
+	RateIn       float64   `json:"rate_in"`
+	LastExchange time.Time `json:"last_exchange"`
+	Freeloader   bool      `json:"freeloader"`
+}
+
+// Ratio is the bytes received from the peer for every byte sent to it.
+func (e LedgerEntry) Ratio() float64 {
+	if e.Sent == 0 {
+		return 0
+	}
+	return float64(e.Received) / float64(e.Sent)
+}
+
+// TitForTat deprioritizes peers that take much more than they give. Once a
+// peer was sent more than Grace bytes, it is a freeloader while it returned
+// less than Ratio of them. A Ratio of 0 disables it.
+type TitForTat struct {
+	Ratio float64 `json:"ratio"`
+	Grace int64   `json:"grace"`
+}
+
+func (t TitForTat) Freeloader(e LedgerEntry) bool {
+	return t.Ratio > 0 && e.Sent > t.Grace && float64(e.Received) < t.Ratio*float64(e.Sent)
+}
+
+// unledgered are the protocols the ledger leaves out. Replicas and proofs
+// are pushed and asked for by this node, a peer holding copies for it is
+// not taking anything.
+var unledgered = map[protocol.ID]bool{
+	utils.ReplicaProtocolID: true,
+	utils.ProofProtocolID:   true,
+}
+
+// ledgerCounter is a bandwidth counter that drops the streams of the
+// unledgered protocols.
+type ledgerCounter struct {
+	*metrics.BandwidthCounter
+}
+
+func (c ledgerCounter) LogSentMessageStream(size int64, proto protocol.ID, p peer.ID) {
+	if !unledgered[proto] {
+		c.BandwidthCounter.LogSentMessageStream(size, proto, p)
+	}
+}
+
+func (c ledgerCounter) LogRecvMessageStream(size int64, proto protocol.ID, p peer.ID) {
+	if !unledgered[proto] {
+		c.BandwidthCounter.LogRecvMessageStream(size, proto, p)
+	}
+}
+
+// Ledger keeps per-peer byte counters fed by the libp2p bandwidth reporter.
+// The reporter only counts since the host started, the ledger folds what it
+// counted into the persisted totals.
+type Ledger struct {
+	mu      sync.Mutex
+	path    string
+	peers   map[string]LedgerEntry
+	counter ledgerCounter
+	// folded holds the reporter totals already added to peers.
+	folded map[peer.ID]metrics.Stats
+}
+
+// NewLedger loads the ledger persisted at path.
+func NewLedger(path string) (*Ledger, error) {
+	l := &Ledger{
+		path:    path,
+		peers:   make(map[string]LedgerEntry),
+		counter: ledgerCounter{metrics.NewBandwidthCounter()},
+		folded:  make(map[peer.ID]metrics.Stats),
+	}
+
+	if err := utils.ReadJSONFile(path, &l.peers); err != nil {
+		return nil, fmt.Errorf("failed to load ledger: %w", err)
+	}
+	return l, nil
+}
+
+// Reporter is the bandwidth reporter the host counts into.
+func (l *Ledger) Reporter() metrics.Reporter {
+	return l.counter
+}
+
+// Monitor persists the counters every interval.
+func (l *Ledger) Monitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			l.Sync()
+			return
+		case <-ticker.C:
+			l.Sync()
+		}
+	}
+}
+
+// Sync folds the bytes counted since the last sync into the totals and
+// persists them.
+func (l *Ledger) Sync() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	changed := false
+	for id, stats := range l.counter.GetBandwidthByPeer() {
+		e := l.pendingLocked(id, stats)
+		if e.Sent != l.peers[id.String()].Sent || e.Received != l.peers[id.String()].Received {
+			changed = true
+		}
+		l.peers[id.String()] = e
+		l.folded[id] = stats
+	}
+
+	if changed && l.path != "" {
+		totals := make(map[string]LedgerEntry, len(l.peers))
+		for id, e := range l.peers {
+			e.RateOut, e.RateIn = 0, 0
+			totals[id] = e
+		}
+		if err := utils.WriteJSONFile(l.path, totals); err != nil {
+			log.Printf("failed to persist ledger: %v\n", err)
+		}
+	}
+}
+
+// Get returns the entry of id including the bytes not synced yet.
+func (l *Ledger) Get(id peer.ID) LedgerEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.pendingLocked(id, l.counter.GetBandwidthForPeer(id))
+}
+
+// Entries returns every peer, the ones sent the most first.
+func (l *Ledger) Entries() []LedgerEntry {
+	l.Sync()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entries := make([]LedgerEntry, 0, len(l.peers))
+	for _, e := range l.peers {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Sent != entries[j].Sent {
+			return entries[i].Sent > entries[j].Sent
+		}
+		return entries[i].Peer < entries[j].Peer
+	})
+	return entries
+}
+
+// pendingLocked adds to the entry of id what stats counted past the last
+// sync, it must be called with the lock held.
+func (l *Ledger) pendingLocked(id peer.ID, stats metrics.Stats) LedgerEntry {
+	e := l.peers[id.String()]
+	e.Peer = id.String()
+	folded := l.folded[id]
+	sent, received := stats.TotalOut-folded.TotalOut, stats.TotalIn-folded.TotalIn
+	if sent > 0 || received > 0 {
+		e.LastExchange = time.Now().UTC()
+	}
+	e.Sent += sent
+	e.Received += received
+	e.RateOut, e.RateIn = stats.RateOut, stats.RateIn
+	return e
+}
+
+func (n *Network) TitForTat() TitForTat {
+	return n.titForTat
+}
+
+// Ledger returns the bytes exchanged with every peer, nil when the node
+// does not keep a ledger.
+func (n *Network) Ledger() []LedgerEntry {
+	if n.ledger == nil {
+		return nil
+	}
+	entries := n.ledger.Entries()
+	for i := range entries {
+		entries[i].Freeloader = n.titForTat.Freeloader(entries[i])
+	}
+	return entries
+}
+
+// LedgerEntry returns the bytes exchanged with id.
+func (n *Network) LedgerEntry(id peer.ID) (LedgerEntry, error) {
+	if n.ledger == nil {
+		return LedgerEntry{}, fmt.Errorf("the node keeps no ledger")
+	}
+	e := n.ledger.Get(id)
+	e.Freeloader = n.titForTat.Freeloader(e)
+	return e, nil
+}
+
+// admit holds back freeloaders until the slot they share is free, other
+// peers are served right away. The returned func frees the slot.
+func (n *Network) admit(id peer.ID) (func(), error) {
+	if n.ledger == nil || !n.titForTat.Freeloader(n.ledger.Get(id)) {
+		return func() {}, nil
+	}
+
+	log.Printf("tit-for-tat: deprioritizing peer: %s\n", id)
+	select {
+	case n.freeloaders <- struct{}{}:
+		return func() { <-n.freeloaders }, nil
+	case <-n.ctx.Done():
+		return nil, n.ctx.Err()
+	}
+}
@@ -1,29 +1,254 @@
 package networking
 
-import "sync"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gokul656/obscure-fs/utils"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// registrationMaxAge bounds how long a signed registration can be replayed.
+const registrationMaxAge = 5 * time.Minute
+
+// sweepConcurrency bounds how many nodes a sweep pings at once.
+const sweepConcurrency = 16
+
+// Node roles, gateways serve the API and retrievals but hold no replicas.
+const (
+	RoleStorage = "storage"
+	RoleGateway = "gateway"
+)
 
 type Node struct {
-	ID       string `json:"id"`
-	APIPort  string `json:"api_port"`
-	Address  string `json:"address"`
-	IsOnline bool   `json:"is_online"`
+	ID           string   `json:"id"`
+	Addresses    []string `json:"addresses"`
+	APIEndpoints []string `json:"api_endpoints"`
+	Zone         string   `json:"zone,omitempty"`
+	Role         string   `json:"role,omitempty"`
+	// Capacity and Free are in bytes, a Capacity of 0 is not advertised.
+	Capacity int64     `json:"capacity"`
+	Free     int64     `json:"free"`
+	IsOnline bool      `json:"is_online"`
+	LastSeen time.Time `json:"last_seen"`
+	// Flagged is set by this node when the node fails a storage proof, it is
+	// not part of what nodes announce about themselves. FailedProofs are
+	// the CIDs it failed and has not proved since.
+	Flagged      bool     `json:"flagged,omitempty"`
+	FlagReason   string   `json:"flag_reason,omitempty"`
+	FailedProofs []string `json:"failed_proofs,omitempty"`
+}
+
+func ParseRole(s string) (string, error) {
+	switch s {
+	case "", RoleStorage:
+		return RoleStorage, nil
+	case RoleGateway:
+		return RoleGateway, nil
+	default:
+		return "", fmt.Errorf("unknown node role: %s", s)
+	}
+}
+
+// SignedRegistration is what a node posts to announce itself. The public key
+// must hash to the node ID, and the signature covers the node and timestamp.
+type SignedRegistration struct {
+	Node      Node   `json:"node"`
+	Timestamp int64  `json:"timestamp"`
+	PublicKey []byte `json:"public_key"`
+	Signature []byte `json:"signature"`
+}
+
+func (r SignedRegistration) payload() ([]byte, error) {
+	return json.Marshal(struct {
+		ID           string   `json:"id"`
+		Addresses    []string `json:"addresses"`
+		APIEndpoints []string `json:"api_endpoints"`
+		Zone         string   `json:"zone"`
+		Role         string   `json:"role"`
+		Capacity     int64    `json:"capacity"`
+		Free         int64    `json:"free"`
+		Timestamp    int64    `json:"timestamp"`
+	}{r.Node.ID, r.Node.Addresses, r.Node.APIEndpoints, r.Node.Zone, r.Node.Role, r.Node.Capacity, r.Node.Free, r.Timestamp})
+}
+
+func SignRegistration(key crypto.PrivKey, node Node) (SignedRegistration, error) {
+	pub, err := crypto.MarshalPublicKey(key.GetPublic())
+	if err != nil {
+		return SignedRegistration{}, err
+	}
+
+	reg := SignedRegistration{Node: node, Timestamp: time.Now().Unix(), PublicKey: pub}
+	payload, err := reg.payload()
+	if err != nil {
+		return SignedRegistration{}, err
+	}
+
+	reg.Signature, err = key.Sign(payload)
+	return reg, err
+}
+
+func (r SignedRegistration) Verify() error {
+	pub, err := crypto.UnmarshalPublicKey(r.PublicKey)
+	if err != nil {
+		return fmt.Errorf("invalid public key: %w", err)
+	}
+
+	id, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		return err
+	}
+	if id.String() != r.Node.ID {
+		return errors.New("public key does not match node ID")
+	}
+
+	age := time.Since(time.Unix(r.Timestamp, 0))
+	if age > registrationMaxAge || age < -registrationMaxAge {
+		return errors.New("registration timestamp out of range")
+	}
+
+	payload, err := r.payload()
+	if err != nil {
+		return err
+	}
+	ok, err := pub.Verify(payload, r.Signature)
+	if err != nil || !ok {
+		return errors.New("invalid registration signature")
+	}
+	return nil
 }
 
 type NodeRegistry struct {
 	mu    sync.RWMutex
+	path  string
 	nodes map[string]Node
 }
 
-func NewNodeRegistry() *NodeRegistry {
-	return &NodeRegistry{
+// NewNodeRegistry loads the registry persisted at path, nodes start offline
+// until they are seen again.
+func NewNodeRegistry(path string) (*NodeRegistry, error) {
+	nr := &NodeRegistry{
+		path:  path,
 		nodes: make(map[string]Node),
 	}
+
+	if err := utils.ReadJSONFile(path, &nr.nodes); err != nil {
+		return nil, fmt.Errorf("failed to load node registry: %w", err)
+	}
+	for id, node := range nr.nodes {
+		node.IsOnline = false
+		nr.nodes[id] = node
+	}
+	return nr, nil
 }
 
 func (nr *NodeRegistry) RegisterNode(node Node) {
 	nr.mu.Lock()
 	defer nr.mu.Unlock()
+	current, ok := nr.nodes[node.ID]
+	node.Flagged, node.FlagReason, node.FailedProofs = current.Flagged, current.FlagReason, current.FailedProofs
+	node.IsOnline = true
+	node.LastSeen = time.Now()
 	nr.nodes[node.ID] = node
+	// heartbeats only refresh liveness and free space, which sweep persists
+	// each interval, so only membership changes are written right away
+	if !ok || !current.sameAnnouncement(node) {
+		nr.save()
+	}
+}
+
+// sameAnnouncement reports whether two announcements describe a node the
+// same way, apart from its free space.
+func (n Node) sameAnnouncement(o Node) bool {
+	return n.ID == o.ID && n.Zone == o.Zone && n.Role == o.Role && n.Capacity == o.Capacity &&
+		slices.Equal(n.Addresses, o.Addresses) && slices.Equal(n.APIEndpoints, o.APIEndpoints)
+}
+
+// Flag marks a registered node as failing to hold cid. Nodes that are not
+// registered are not tracked, it reports whether the node was flagged.
+func (nr *NodeRegistry) Flag(id, cid string) bool {
+	nr.mu.Lock()
+	defer nr.mu.Unlock()
+	node, ok := nr.nodes[id]
+	if !ok {
+		return false
+	}
+	if !slices.Contains(node.FailedProofs, cid) {
+		node.FailedProofs = append(slices.Clone(node.FailedProofs), cid)
+	}
+	node.Flagged = true
+	node.FlagReason = fmt.Sprintf("failed storage proof of CID: %s", cid)
+	nr.nodes[id] = node
+	nr.save()
+	return true
+}
+
+// PassedProof records that a node proved it holds cid. Its flag is lifted
+// once it has proved every CID it failed, it reports whether it was.
+func (nr *NodeRegistry) PassedProof(id, cid string) bool {
+	nr.mu.Lock()
+	defer nr.mu.Unlock()
+	node, ok := nr.nodes[id]
+	if !ok || !slices.Contains(node.FailedProofs, cid) {
+		return false
+	}
+	node.FailedProofs = slices.DeleteFunc(slices.Clone(node.FailedProofs), func(c string) bool { return c == cid })
+	if len(node.FailedProofs) > 0 {
+		node.FlagReason = fmt.Sprintf("failed storage proof of CID: %s", node.FailedProofs[0])
+		nr.nodes[id] = node
+		nr.save()
+		return false
+	}
+	node.FailedProofs = nil
+	node.Flagged = false
+	node.FlagReason = ""
+	nr.nodes[id] = node
+	nr.save()
+	return true
+}
+
+// FailedProofs returns the nodes that failed a storage proof of cid.
+func (nr *NodeRegistry) FailedProofs(cid string) []string {
+	nr.mu.RLock()
+	defer nr.mu.RUnlock()
+	var ids []string
+	for id, node := range nr.nodes {
+		if slices.Contains(node.FailedProofs, cid) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Unflag lifts the flag of a node whatever it failed, it reports whether the
+// node was flagged.
+func (nr *NodeRegistry) Unflag(id string) bool {
+	nr.mu.Lock()
+	defer nr.mu.Unlock()
+	node, ok := nr.nodes[id]
+	if !ok || !node.Flagged {
+		return false
+	}
+	node.Flagged = false
+	node.FlagReason = ""
+	node.FailedProofs = nil
+	nr.nodes[id] = node
+	nr.save()
+	return true
+}
+
+func (nr *NodeRegistry) IsFlagged(id string) bool {
+	node, ok := nr.GetNode(id)
+	return ok && node.Flagged
 }
 
 func (nr *NodeRegistry) GetAllNodes() []Node {
@@ -35,3 +260,90 @@ func (nr *NodeRegistry) GetAllNodes() []Node {
 	}
 	return nodes
 }
+
+func (nr *NodeRegistry) GetNode(id string) (Node, bool) {
+	nr.mu.RLock()
+	defer nr.mu.RUnlock()
+	node, ok := nr.nodes[id]
+	return node, ok
+}
+
+// save must be called with the lock held.
+func (nr *NodeRegistry) save() {
+	if nr.path == "" {
+		return
+	}
+	if err := utils.WriteJSONFile(nr.path, nr.nodes); err != nil {
+		log.Printf("failed to persist node registry: %v\n", err)
+	}
+}
+
+// Monitor pings every registered node each interval. Nodes unreachable for
+// offlineAfter are marked offline and removed once unreachable for evictAfter.
+func (nr *NodeRegistry) Monitor(ctx context.Context, n *Network, interval, offlineAfter, evictAfter time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			nr.sweep(ctx, n, offlineAfter, evictAfter)
+		}
+	}
+}
+
+func (nr *NodeRegistry) sweep(ctx context.Context, n *Network, offlineAfter, evictAfter time.Duration) {
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		seen = make(map[string]bool)
+		sem  = make(chan struct{}, sweepConcurrency)
+	)
+	for _, node := range nr.GetAllNodes() {
+		id, err := peer.Decode(node.ID)
+		if err != nil || id == n.host.ID() {
+			continue
+		}
+
+		for _, a := range node.Addresses {
+			if addr, err := multiaddr.NewMultiaddr(a); err == nil {
+				n.host.Peerstore().AddAddr(id, addr, peerstore.RecentlyConnectedAddrTTL)
+			}
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			if _, err := n.Ping(ctx, id); err == nil {
+				mu.Lock()
+				seen[node.ID] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	nr.mu.Lock()
+	defer nr.mu.Unlock()
+
+	now := time.Now()
+	for id, node := range nr.nodes {
+		switch {
+		case seen[id]:
+			node.IsOnline = true
+			node.LastSeen = now
+		case now.Sub(node.LastSeen) > evictAfter:
+			log.Printf("evicting stale node: %s\n", id)
+			delete(nr.nodes, id)
+			continue
+		case node.IsOnline && now.Sub(node.LastSeen) > offlineAfter:
+			log.Printf("node went offline: %s\n", id)
+			node.IsOnline = false
+		}
+		nr.nodes[id] = node
+	}
+	nr.save()
+}
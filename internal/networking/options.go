@@ -0,0 +1,230 @@
+package networking
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gokul656/obscure-fs/internal/codec"
+	"github.com/gokul656/obscure-fs/internal/placement"
+	"github.com/gokul656/obscure-fs/internal/storage"
+	"github.com/gokul656/obscure-fs/internal/throttle"
+	"github.com/gokul656/obscure-fs/utils"
+	"github.com/libp2p/go-libp2p"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p-kad-dht/dual"
+	"github.com/libp2p/go-libp2p/core/pnet"
+	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
+)
+
+type options struct {
+	swarmKey    pnet.PSK
+	gater       *Gater
+	cacheLimit  int64
+	cachePolicy storage.EvictionPolicy
+	reprovide   bool
+	replication ReplicationPolicy
+	profile     Profile
+	placement   placement.Strategy
+
+	rebalanceBandwidth int64
+	replicatePrivate   bool
+	ledger             *Ledger
+	titForTat          TitForTat
+	throttle           *throttle.Throttler
+	health             HealthPolicy
+	timeouts           Timeouts
+	padding            codec.PaddingPolicy
+	registry           *NodeRegistry
+}
+
+// Profile is what a node advertises about itself for placement.
+type Profile struct {
+	Zone     string
+	Role     string
+	Capacity int64
+}
+
+type Option func(*options) error
+
+// WithSwarmKey isolates the node in a private network, only peers holding
+// the same pre-shared key can connect.
+func WithSwarmKey(path string) Option {
+	return func(o *options) error {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		o.swarmKey, err = pnet.DecodeV1PSK(f)
+		return err
+	}
+}
+
+// WithGater filters connections and streams through the allow and deny lists.
+func WithGater(g *Gater) Option {
+	return func(o *options) error {
+		o.gater = g
+		return nil
+	}
+}
+
+// WithRegistry sets the registry that node announcements fill in and that
+// placement and proofs consult for zones and flagged peers.
+func WithRegistry(registry *NodeRegistry) Option {
+	return func(o *options) error {
+		o.registry = registry
+		return nil
+	}
+}
+
+// WithCache bounds the retrieval cache to limit bytes, evicting by policy.
+func WithCache(limit int64, policy storage.EvictionPolicy) Option {
+	return func(o *options) error {
+		o.cacheLimit = limit
+		o.cachePolicy = policy
+		return nil
+	}
+}
+
+// WithCacheReprovide advertises cached public content on the DHT and
+// serves it to other peers.
+func WithCacheReprovide() Option {
+	return func(o *options) error {
+		o.reprovide = true
+		return nil
+	}
+}
+
+// WithPrivateReplication lets private uploads be replicated. Peers receive
+// and store them in plaintext.
+func WithPrivateReplication() Option {
+	return func(o *options) error {
+		o.replicatePrivate = true
+		return nil
+	}
+}
+
+// WithReplication sets the replication policy of uploads that do not pick
+// their own.
+func WithReplication(policy ReplicationPolicy) Option {
+	return func(o *options) error {
+		if policy.Factor < 1 || policy.Quorum < 0 {
+			return fmt.Errorf("invalid replication policy: factor %d, quorum %d", policy.Factor, policy.Quorum)
+		}
+		o.replication = policy
+		return nil
+	}
+}
+
+// WithPadding pads the shards of uploads that do not pick their own
+// padding policy.
+func WithPadding(policy codec.PaddingPolicy) Option {
+	return func(o *options) error {
+		o.padding = policy
+		return nil
+	}
+}
+
+// WithProfile advertises the zone, role and capacity of the node.
+func WithProfile(profile Profile) Option {
+	return func(o *options) error {
+		role, err := ParseRole(profile.Role)
+		if err != nil {
+			return err
+		}
+		profile.Role = role
+		o.profile = profile
+		return nil
+	}
+}
+
+// WithPlacement picks the peers that copies of a file go to.
+func WithPlacement(strategy placement.Strategy) Option {
+	return func(o *options) error {
+		o.placement = strategy
+		return nil
+	}
+}
+
+// WithRebalanceBandwidth caps the bytes per second a rebalance pushes, 0
+// means unlimited.
+func WithRebalanceBandwidth(bytesPerSecond int64) Option {
+	return func(o *options) error {
+		o.rebalanceBandwidth = bytesPerSecond
+		return nil
+	}
+}
+
+// WithLedger counts the bytes exchanged with each peer into ledger, and
+// deprioritizes freeloaders when policy is enabled.
+func WithLedger(ledger *Ledger, policy TitForTat) Option {
+	return func(o *options) error {
+		if policy.Ratio < 0 || policy.Grace < 0 {
+			return fmt.Errorf("invalid tit-for-tat policy: ratio %g, grace %d", policy.Ratio, policy.Grace)
+		}
+		o.ledger = ledger
+		o.titForTat = policy
+		return nil
+	}
+}
+
+// WithThrottle paces transfers to the rate limits and background windows of
+// t.
+func WithThrottle(t *throttle.Throttler) Option {
+	return func(o *options) error {
+		o.throttle = t
+		return nil
+	}
+}
+
+// WithHealthPolicy sets how requests to providers are retried and when the
+// circuit of a failing peer opens.
+func WithHealthPolicy(policy HealthPolicy) Option {
+	return func(o *options) error {
+		if policy.Retries < 0 || policy.FailureThreshold < 1 || policy.BaseBackoff < 0 || policy.MaxBackoff < 0 || policy.Cooldown < 0 {
+			return fmt.Errorf("invalid health policy: %+v", policy)
+		}
+		o.health = policy
+		return nil
+	}
+}
+
+// WithTimeouts bounds lookups, announcements, requests and transfers.
+func WithTimeouts(timeouts Timeouts) Option {
+	return func(o *options) error {
+		if timeouts.Lookup < 0 || timeouts.Announce < 0 || timeouts.Request < 0 || timeouts.Transfer < 0 {
+			return fmt.Errorf("invalid timeouts: %+v", timeouts)
+		}
+		o.timeouts = timeouts
+		return nil
+	}
+}
+
+func (o *options) hostOptions() []libp2p.Option {
+	var opts []libp2p.Option
+	if o.gater != nil {
+		opts = append(opts, libp2p.ConnectionGater(o.gater))
+	}
+	if o.ledger != nil {
+		opts = append(opts, libp2p.BandwidthReporter(o.ledger.Reporter()))
+	}
+
+	if len(o.swarmKey) > 0 {
+		// QUIC, WebTransport and WebRTC cannot run behind a PSK, TCP only
+		opts = append(opts,
+			libp2p.PrivateNetwork(o.swarmKey),
+			libp2p.Transport(tcp.NewTCPTransport),
+		)
+	}
+	return opts
+}
+
+func (o *options) dhtOptions() []dual.Option {
+	if len(o.swarmKey) == 0 {
+		return []dual.Option{dual.DHTOption()}
+	}
+
+	// a private swarm must not speak the public IPFS DHT protocol
+	return []dual.Option{dual.DHTOption(dht.ProtocolPrefix(utils.DHTProtocolPrefix))}
+}
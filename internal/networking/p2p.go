@@ -1,7 +1,7 @@
 package networking
 
 import (
-	"bytes"
+	"bufio"
 	"context"
 	"crypto/x509"
 	"encoding/json"
@@ -9,25 +9,40 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/gokul656/obscure-fs/internal/capability"
+	"github.com/gokul656/obscure-fs/internal/codec"
 	"github.com/gokul656/obscure-fs/internal/hashing"
+	"github.com/gokul656/obscure-fs/internal/pinset"
+	"github.com/gokul656/obscure-fs/internal/placement"
 	"github.com/gokul656/obscure-fs/internal/storage"
+	"github.com/gokul656/obscure-fs/internal/throttle"
 	"github.com/gokul656/obscure-fs/utils"
 	"github.com/ipfs/go-cid"
 	"github.com/libp2p/go-libp2p"
 	"github.com/libp2p/go-libp2p-kad-dht/dual"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/peerstore"
 	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
 	"github.com/multiformats/go-multiaddr"
 )
 
+const (
+	// maxCommandSize caps a request line, it leaves room for a capability
+	// token after the CID.
+	maxCommandSize = 4096
+)
+
 type Network struct {
 	ctx            context.Context
 	port           int
@@ -35,22 +50,63 @@ type Network struct {
 	dht            *dual.DHT
 	bootstrapNodes []string
 	fileStore      *storage.FileStore
+	cache          *storage.Cache
+	fetchesMu      sync.Mutex
+	fetches        map[string]*sharedFetch
+	reprovide      bool
+	replication    ReplicationPolicy
+	padding        codec.PaddingPolicy
+	profile        Profile
+	placement      placement.Strategy
+	registry       *NodeRegistry
+	pins           *pinset.Set
+	pinsChanged    func()
+
+	rebalancer         *rebalancer
+	rebalanceBandwidth int64
+	replicatePrivate   bool
+	gater              *Gater
+	pubsub             *pubsub.PubSub
+	catalog            *Catalog
+
+	throttle  *throttle.Throttler
+	health    *HealthTracker
+	timeouts  Timeouts
+	ledger    *Ledger
+	titForTat TitForTat
+	// freeloaders is the one slot that peers deprioritized by tit-for-tat
+	// share to be served.
+	freeloaders chan struct{}
+
+	topicsMu sync.Mutex
+	topics   map[string]*pubsub.Topic
+
+	authMu          sync.RWMutex
+	authorizedPeers map[peer.ID]bool
 }
 
-func NewNetwork(ctx context.Context, port int, pkey string, bootstrapNodes []string, fs *storage.FileStore) *Network {
+func NewNetwork(ctx context.Context, port int, pkey string, bootstrapNodes []string, fs *storage.FileStore, opts ...Option) *Network {
 	var host host.Host
 	addresses := libp2p.ListenAddrStrings(
 		fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", port),
 		fmt.Sprintf("/ip6/::/tcp/%d", port),
 	)
 
+	cfg := &options{profile: Profile{Role: RoleStorage}, placement: placement.Rendezvous{}, health: DefaultHealthPolicy, timeouts: DefaultTimeouts, padding: codec.NoPadding{}}
+	for _, opt := range opts {
+		if err := opt(cfg); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	hostOpts := append(cfg.hostOptions(), addresses)
+
 	privKey, err := LoadPrivateKey(pkey)
 	if err == nil {
-		host, err = libp2p.New(libp2p.Identity(privKey), addresses)
+		host, err = libp2p.New(append(hostOpts, libp2p.Identity(privKey))...)
 	} else {
 		log.Printf("unable to load PKEY %v, error: %v\n", pkey, err)
 		log.Println("generate new keypairs...")
-		host, err = libp2p.New(addresses)
+		host, err = libp2p.New(hostOpts...)
 	}
 
 	if err != nil {
@@ -58,7 +114,7 @@ func NewNetwork(ctx context.Context, port int, pkey string, bootstrapNodes []str
 	}
 
 	// creating new Distributed Hash Table
-	dhtInstance, err := dual.New(ctx, host, dual.DHTOption())
+	dhtInstance, err := dual.New(ctx, host, cfg.dhtOptions()...)
 	if err != nil {
 		log.Fatalln(err)
 	}
@@ -68,14 +124,46 @@ func NewNetwork(ctx context.Context, port int, pkey string, bootstrapNodes []str
 		log.Fatalln(err)
 	}
 
+	ps, err := pubsub.NewGossipSub(ctx, host)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	cache, err := storage.NewCache(filepath.Join(utils.TempPath, host.ID().String()), cfg.cacheLimit, cfg.cachePolicy)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
 	log.Printf("Host created. Listening on: %s\n", host.Addrs())
 	return &Network{
-		ctx:            ctx,
-		port:           port,
-		host:           host,
-		dht:            dhtInstance,
-		bootstrapNodes: bootstrapNodes,
-		fileStore:      fs,
+		ctx:                ctx,
+		port:               port,
+		host:               host,
+		dht:                dhtInstance,
+		bootstrapNodes:     bootstrapNodes,
+		fileStore:          fs,
+		cache:              cache,
+		fetches:            make(map[string]*sharedFetch),
+		reprovide:          cfg.reprovide,
+		replication:        cfg.replication,
+		padding:            cfg.padding,
+		profile:            cfg.profile,
+		placement:          cfg.placement,
+		rebalancer:         newRebalancer(cfg.rebalanceBandwidth),
+		rebalanceBandwidth: cfg.rebalanceBandwidth,
+		replicatePrivate:   cfg.replicatePrivate,
+		throttle:           cfg.throttle,
+		health:             NewHealthTracker(cfg.health),
+		timeouts:           cfg.timeouts,
+		registry:           cfg.registry,
+		ledger:             cfg.ledger,
+		titForTat:          cfg.titForTat,
+		freeloaders:        make(chan struct{}, 1),
+		gater:              cfg.gater,
+		pubsub:             ps,
+		catalog:            NewCatalog(),
+		topics:             make(map[string]*pubsub.Topic),
+		authorizedPeers:    make(map[peer.ID]bool),
 	}
 }
 
@@ -83,13 +171,51 @@ func (n *Network) GetHost() host.Host {
 	return n.host
 }
 
-func (n *Network) FindPeer(peerID string) (peer.AddrInfo, error) {
+func (n *Network) Cache() *storage.Cache {
+	return n.cache
+}
+
+// Padding is the padding policy of uploads that do not pick their own.
+func (n *Network) Padding() codec.PaddingPolicy {
+	return n.padding
+}
+
+func (n *Network) Throttle() *throttle.Throttler {
+	return n.throttle
+}
+
+func (n *Network) Gater() *Gater {
+	return n.gater
+}
+
+// EnforceGater drops open connections that the current lists reject, the
+// gater itself is only consulted when a connection is established.
+func (n *Network) EnforceGater() {
+	if n.gater == nil {
+		return
+	}
+
+	for _, conn := range n.host.Network().Conns() {
+		if n.gater.Allowed(conn.RemotePeer(), conn.RemoteMultiaddr()) {
+			continue
+		}
+
+		log.Printf("gater: closing connection with peer: %s at: %s\n", conn.RemotePeer(), conn.RemoteMultiaddr())
+		if err := conn.Close(); err != nil {
+			log.Printf("failed to close connection with peer: %s, error: %v\n", conn.RemotePeer(), err)
+		}
+	}
+}
+
+func (n *Network) FindPeer(ctx context.Context, peerID string) (peer.AddrInfo, error) {
 	id, err := peer.Decode(peerID)
 	if err != nil {
 		return peer.AddrInfo{}, err
 	}
 
-	peerInfo, err := n.dht.FindPeer(n.ctx, id)
+	ctx, cancel := withTimeout(ctx, n.timeouts.Lookup)
+	defer cancel()
+	peerInfo, err := n.dht.FindPeer(ctx, id)
 	if err != nil {
 		return peer.AddrInfo{}, err
 	}
@@ -97,83 +223,219 @@ func (n *Network) FindPeer(peerID string) (peer.AddrInfo, error) {
 	return peerInfo, nil
 }
 
-func (n *Network) AnnounceFile(id string) error {
-	return n.dht.Provide(n.ctx, cid.MustParse(id), true)
+func (n *Network) AnnounceFile(ctx context.Context, id string) error {
+	c, err := cid.Decode(id)
+	if err != nil {
+		return fmt.Errorf("invalid CID: %q", id)
+	}
+
+	ctx, cancel := withTimeout(ctx, n.timeouts.Announce)
+	defer cancel()
+	return n.dht.Provide(ctx, c, true)
 }
 
-func (n *Network) FindFile(id string) ([]peer.AddrInfo, error) {
-	peerChan := n.dht.FindProvidersAsync(n.ctx, cid.MustParse(id), 10)
+// FindFile looks up the providers of id on the DHT. The lookup ends with the
+// first 10 providers, the lookup timeout or ctx, and fails only when it
+// found none before ctx or the timeout ended it.
+func (n *Network) FindFile(ctx context.Context, id string) ([]peer.AddrInfo, error) {
+	c, err := cid.Decode(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CID: %q", id)
+	}
+
+	ctx, cancel := withTimeout(ctx, n.timeouts.Lookup)
+	defer cancel()
+	peerChan := n.dht.FindProvidersAsync(ctx, c, 10)
 	peers := make([]peer.AddrInfo, 0)
 	for p := range peerChan {
 		peers = append(peers, p)
 	}
 
+	if len(peers) == 0 && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
 	return peers, nil
 }
 
-func (n *Network) ShareFile(path string) (cid string, err error) {
+// ShareFile stores the file at path under its CID with the descriptive
+// fields of entry, and advertises it according to its visibility. When
+// entry.Codec names a padding policy, the content is also erasure coded into
+// padded shards. limit bounds the bytes entry.Uploader holds, see
+// storage.FileStore.StoreFileWithin. Content that is already stored keeps
+// its entry, ShareFile then returns its CID with storage.ErrFileExists and
+// leaves path to the caller.
+func (n *Network) ShareFile(ctx context.Context, path string, entry storage.FileEntry, limit int64) (cid string, err error) {
 	cid, err = hashing.HashFile(path)
 	if err != nil {
 		return
 	}
+	// checked before encoding too, shards are written under the CID
+	if _, stored := n.fileStore.GetEntry(cid); stored == nil {
+		return cid, storage.ErrFileExists
+	}
 
-	err = n.fileStore.StoreFile(cid, path)
+	entry.Path = path
+	entry.Size, err = storage.GetFileSize(path)
 	if err != nil {
 		return
 	}
+	if entry.UploadedAt.IsZero() {
+		entry.UploadedAt = time.Now().UTC()
+	}
+	if entry.Codec.Padding != "" && entry.Codec.Padding != (codec.NoPadding{}).String() {
+		err = encodePadded(cid, &entry)
+		if err != nil {
+			return
+		}
+	}
+	if entry.Codec.Name == "" {
+		entry.Codec = storage.RawCodec
+	}
 
-	err = n.AnnounceFile(cid)
+	err = n.fileStore.StoreFileWithin(cid, entry, limit)
 	if err != nil {
 		return
 	}
 
+	// private content is not advertised, authorized peers are expected to
+	// know where to ask for it
+	if entry.Visibility != storage.Private {
+		err = n.AnnounceFile(ctx, cid)
+		if err != nil {
+			return
+		}
+	}
+
+	if entry.Visibility == storage.Public {
+		n.announceFile(FileAdded, entry.Document(cid))
+	}
+
 	log.Printf("File shared with CID: %s\n", cid)
 	return cid, nil
 }
 
-func (n *Network) RetrieveFile(cid, outputPath string) error {
+// encodePadded splits the content of entry into erasure coded shards padded
+// by the policy entry.Codec names, and records them as blobs of the entry.
+func encodePadded(cid string, entry *storage.FileEntry) error {
+	policy, err := codec.ParsePaddingPolicy(entry.Codec.Padding)
+	if err != nil {
+		return err
+	}
+
+	content, err := storage.ReadFile(entry.Path)
+	if err != nil {
+		return err
+	}
+	metadata := &storage.Metadata{Name: entry.Name, Checksum: cid}
+	if err := (codec.ErasureCodec{Padding: policy}).Encode(metadata, content); err != nil {
+		return fmt.Errorf("failed to encode CID: %s, error: %w", cid, err)
+	}
+
+	entry.Codec = storage.CodecInfo{
+		Name:       codec.ErasureCodecName,
+		Shards:     metadata.Shards,
+		Parity:     metadata.Pairty,
+		Padding:    metadata.Padding,
+		PaddedSize: int64(policy.PaddedSize(len(content))),
+	}
+	entry.Blobs = metadata.Parts
+	return nil
+}
+
+// paddedContent reads size bytes of content from r followed by zeros up to
+// padded bytes, the form padded files leave the node in. Receivers drop the
+// zeros again with hashing.TrimPadding.
+func paddedContent(r io.Reader, size, padded int64) io.Reader {
+	return io.MultiReader(io.LimitReader(r, size), io.LimitReader(zeros{}, max(padded-size, 0)))
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// RetrieveFile fetches cid, presenting token to providers when it is not
+// empty so that private content can be served. Providers are tried
+// healthiest first, and retried with backoff when all of them fail. Each
+// provider gets the transfer timeout, the whole retrieval stops with ctx.
+func (n *Network) RetrieveFile(ctx context.Context, cid, outputPath, token string) error {
+	return n.retrieve(ctx, cid, outputPath, token, throttle.Interactive)
+}
+
+// retrieve is RetrieveFile for transfers of the given priority class.
+func (n *Network) retrieve(ctx context.Context, cid, outputPath, token string, class throttle.Class) error {
 	path, err := n.fileStore.GetFile(cid)
 	if err == nil {
 		return utils.CopyFile(path, outputPath)
 	}
 
 	log.Printf("file not found locally! searching on the n/w for file: %s", cid)
-	providers, err := n.FindFile(cid)
-	if err != nil || len(providers) == 0 {
+	providers, err := n.FindFile(ctx, cid)
+	if err != nil {
+		return fmt.Errorf("no providers found for CID: %s, error: %w", cid, err)
+	}
+	if len(providers) == 0 {
 		return fmt.Errorf("no providers found for CID: %s", cid)
 	}
 
-	fmt.Printf("providers: %v\n", providers)
+	log.Printf("found %d providers for CID: %s\n", len(providers), cid)
 
+	ids := make([]peer.ID, 0, len(providers))
 	for _, provider := range providers {
-		stream, err := n.host.NewStream(n.ctx, provider.ID, utils.ProtocolID)
+		ids = append(ids, provider.ID)
+	}
+	err = n.tryPeers(ctx, ids, func(id peer.ID) (int64, error) {
+		size, err := n.retrieveFrom(ctx, id, cid, outputPath, token, class)
 		if err != nil {
-			log.Printf("failed to open stream with provider: %s, error: %v\n", provider.ID.String(), err)
-			continue
+			log.Printf("failed to retrieve CID: %s from provider: %s, error: %v\n", cid, id, err)
 		}
-		defer stream.Close()
+		return size, err
+	})
+	if err != nil {
+		return fmt.Errorf("no provider served CID: %s, last error: %w", cid, err)
+	}
 
-		_, err = stream.Write([]byte(cid))
-		if err != nil {
-			log.Printf("failed to send CID to provider: %s, error: %v\n", provider.ID.String(), err)
-			continue
-		}
+	log.Printf("file retrieved successfully and saved at: %s\n", outputPath)
+	return nil
+}
 
-		fileData, err := io.ReadAll(stream)
-		if err != nil {
-			log.Printf("Failed to read file data from provider: %s, error: %v\n", provider.ID.String(), err)
-			continue
-		}
+func (n *Network) retrieveFrom(ctx context.Context, id peer.ID, cid, outputPath, token string, class throttle.Class) (int64, error) {
+	ctx, cancel := withTimeout(ctx, n.timeouts.Transfer)
+	defer cancel()
 
-		err = os.WriteFile(outputPath, fileData, 0644)
-		if err != nil {
-			return fmt.Errorf("failed to save file to path: %s, error: %w", outputPath, err)
-		}
+	stream, err := n.host.NewStream(ctx, id, utils.ProtocolID)
+	if err != nil {
+		return 0, err
+	}
+	defer stream.Close()
+	defer bindStream(ctx, stream)()
 
-		log.Printf("file retrieved successfully and saved at: %s\n", outputPath)
+	request := cid
+	if token != "" {
+		request = fmt.Sprintf("%s %s", cid, token)
+	}
+	if _, err := stream.Write([]byte(request + "\n")); err != nil {
+		return 0, err
 	}
 
-	return nil
+	fileData, err := io.ReadAll(n.throttle.Reader(ctx, stream, id.String(), class))
+	if err != nil {
+		return 0, streamErr(ctx, err)
+	}
+	if len(fileData) == 0 {
+		return 0, errNotServed
+	}
+
+	if err := os.WriteFile(outputPath, fileData, 0644); err != nil {
+		return 0, fmt.Errorf("failed to save file to path: %s, error: %w", outputPath, err)
+	}
+	// padded files arrive zero filled
+	if err := hashing.TrimPadding(outputPath, cid); err != nil {
+		return 0, err
+	}
+	return int64(len(fileData)), nil
 }
 
 func (n *Network) ConnectToBootstrapNodes() {
@@ -203,7 +465,7 @@ func (n *Network) ConnectToBootstrapNodes() {
 	}
 }
 
-func (n *Network) ConnectToPeer(addr string) (err error) {
+func (n *Network) ConnectToPeer(ctx context.Context, addr string) (err error) {
 	mulAddr, err := multiaddr.NewMultiaddr(addr)
 	if err != nil {
 		return
@@ -215,7 +477,7 @@ func (n *Network) ConnectToPeer(addr string) (err error) {
 	}
 
 	n.host.Peerstore().AddAddr(peerInfo.ID, mulAddr, peerstore.PermanentAddrTTL)
-	if err = n.host.Connect(n.ctx, *peerInfo); err != nil {
+	if err = n.host.Connect(ctx, *peerInfo); err != nil {
 		return
 	}
 
@@ -223,44 +485,93 @@ func (n *Network) ConnectToPeer(addr string) (err error) {
 	return nil
 }
 
-func (n *Network) AnnounceToPeers(nodeID, address string) {
-	var p = 1
-	peers := n.host.Peerstore().Peers()
-	for _, peerID := range peers {
+// joinTopic returns the handle for a pubsub topic, joining it only once.
+func (n *Network) joinTopic(name string) (*pubsub.Topic, error) {
+	n.topicsMu.Lock()
+	defer n.topicsMu.Unlock()
 
-		// FIXME : skip self announcement & port issue
-		if peerID == n.GetHost().ID() {
-			continue
-		}
+	if topic, ok := n.topics[name]; ok {
+		return topic, nil
+	}
 
-		peerAddr := fmt.Sprintf("http://localhost:800%d/nodes/register", p)
-		p++
-		body := Node{
-			ID:       nodeID,
-			Address:  address,
-			IsOnline: true,
-		}
+	topic, err := n.pubsub.Join(name)
+	if err != nil {
+		return nil, err
+	}
+	n.topics[name] = topic
+	return topic, nil
+}
 
-		jsonData, _ := json.Marshal(body)
-		resp, err := http.Post(peerAddr, "application/json", bytes.NewBuffer(jsonData))
-		if err != nil {
-			log.Printf("Failed to announce to peer %s: %v\n", peerID, err)
-		} else {
-			log.Printf("Node announced to peer %s: %s\n", peerID, resp.Status)
+// Ping measures the round trip to a peer over the libp2p ping protocol.
+func (n *Network) Ping(ctx context.Context, id peer.ID) (time.Duration, error) {
+	ctx, cancel := withTimeout(ctx, n.timeouts.Request)
+	defer cancel()
+
+	select {
+	case res := <-ping.Ping(ctx, n.host, id):
+		if res.Error == nil {
+			n.health.RecordLatency(id, res.RTT)
 		}
+		return res.RTT, res.Error
+	case <-ctx.Done():
+		return 0, ctx.Err()
 	}
 }
 
 func (n *Network) StartSimpleProtocol(protocolID protocol.ID) {
-	n.host.SetStreamHandler(protocolID, streamHandler(n.fileStore))
+	n.host.SetStreamHandler(protocolID, n.streamHandler)
 }
 
-func (n *Network) SendMessage(peerID peer.ID, protocolID protocol.ID, msg string) (err error) {
-	stream, err := n.host.NewStream(n.ctx, peerID, protocolID)
+// AuthorizePeer allows the peer to retrieve private files from this node.
+func (n *Network) AuthorizePeer(peerID string) error {
+	id, err := peer.Decode(peerID)
+	if err != nil {
+		return err
+	}
+
+	n.authMu.Lock()
+	defer n.authMu.Unlock()
+	n.authorizedPeers[id] = true
+	return nil
+}
+
+func (n *Network) isAuthorized(id peer.ID) bool {
+	n.authMu.RLock()
+	defer n.authMu.RUnlock()
+	return n.authorizedPeers[id]
+}
+
+// IssueToken signs a capability granting read access to cids with the node
+// identity key.
+func (n *Network) IssueToken(cids []string, ttl time.Duration, audience string) (string, error) {
+	key := n.host.Peerstore().PrivKey(n.host.ID())
+	if key == nil {
+		return "", fmt.Errorf("identity key not available")
+	}
+	return capability.Issue(key, cids, ttl, audience)
+}
+
+// VerifyToken checks a token issued by this node for cid. presenter is the
+// remote peer, or empty for HTTP bearers.
+func (n *Network) VerifyToken(token, cid string, presenter peer.ID) error {
+	key := n.host.Peerstore().PubKey(n.host.ID())
+	if key == nil {
+		return fmt.Errorf("identity key not available")
+	}
+	_, err := capability.Verify(key, token, cid, presenter)
+	return err
+}
+
+func (n *Network) SendMessage(ctx context.Context, peerID peer.ID, protocolID protocol.ID, msg string) (err error) {
+	ctx, cancel := withTimeout(ctx, n.timeouts.Request)
+	defer cancel()
+
+	stream, err := n.host.NewStream(ctx, peerID, protocolID)
 	if err != nil {
 		return
 	}
 	defer stream.Close()
+	defer bindStream(ctx, stream)()
 
 	_, err = stream.Write([]byte(msg))
 	if err != nil {
@@ -271,60 +582,132 @@ func (n *Network) SendMessage(peerID peer.ID, protocolID protocol.ID, msg string
 	return nil
 }
 
-func streamHandler(fileStore *storage.FileStore) network.StreamHandler {
-	return func(stream network.Stream) {
-		log.Println("new stream opened")
-		defer stream.Close()
+func (n *Network) streamHandler(stream network.Stream) {
+	log.Println("new stream opened")
+	defer stream.Close()
+
+	conn := stream.Conn()
+	if n.gater != nil && !n.gater.Allowed(conn.RemotePeer(), conn.RemoteMultiaddr()) {
+		log.Printf("gater: rejected stream from peer: %s at: %s\n", conn.RemotePeer(), conn.RemoteMultiaddr())
+		stream.Reset()
+		return
+	}
+
+	// a request is a single line, a peer that closes its side may leave out
+	// the newline
+	line, err := bufio.NewReader(io.LimitReader(stream, maxCommandSize)).ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		log.Printf("error reading from stream: %s\n", err)
+		return
+	}
+	if err == io.EOF && len(line) == maxCommandSize {
+		log.Printf("request from peer: %s is too long\n", conn.RemotePeer())
+		return
+	}
+
+	command := strings.TrimRight(line, "\r\n")
+	log.Printf("received command: %s\n", command)
 
-		buf := make([]byte, 256)
-		n, err := stream.Read(buf)
+	switch {
+	case strings.HasPrefix(command, "stat "):
+		// "stat <cid>" optionally followed by a capability token
+		cid, token, _ := strings.Cut(strings.TrimPrefix(command, "stat "), " ")
+		entry, err := n.fileStore.GetEntry(cid)
 		if err != nil {
-			log.Printf("error reading from stream: %s\n", err)
+			log.Printf("file not found for CID: %s\n", cid)
+			return
+		}
+		if !n.canServe(entry, cid, token, conn.RemotePeer()) {
 			return
 		}
 
-		command := string(buf[:n])
-		log.Printf("received command: %s\n", command)
+		response, err := json.Marshal(entry.Stat(cid, n.host.ID().String()))
+		if err != nil {
+			log.Printf("failed to encode stat: %s\n", err)
+			return
+		}
+		if _, err := stream.Write(response); err != nil {
+			log.Printf("error writing stat to stream: %s\n", err)
+		}
 
-		switch command {
-		case "list_files":
-			files := fileStore.ListFiles()
-			response, err := json.Marshal(files)
-			if err != nil {
-				log.Printf("failed to encode file list: %s\n", err)
-				return
-			}
-			_, err = stream.Write(response)
-			if err != nil {
-				log.Printf("error writing file list to stream: %s\n", err)
-			} else {
-				log.Println("file list sent successfully")
-			}
+	case command == "list_files":
+		files := n.fileStore.ListPublicFiles()
+		response, err := json.Marshal(files)
+		if err != nil {
+			log.Printf("failed to encode file list: %s\n", err)
+			return
+		}
+		_, err = stream.Write(response)
+		if err != nil {
+			log.Printf("error writing file list to stream: %s\n", err)
+		} else {
+			log.Println("file list sent successfully")
+		}
 
-		default:
-			cid := command
-			path, err := fileStore.GetFile(cid)
-			if err != nil {
+	default:
+		// a retrieval is "<cid>" optionally followed by a capability token
+		cid, token, _ := strings.Cut(command, " ")
+		entry, err := n.fileStore.GetEntry(cid)
+		path, padded := entry.Path, entry.PublicSize()
+		if err != nil {
+			var ok bool
+			path, padded, ok = n.cachedForPeers(cid)
+			if !ok {
 				log.Printf("file not found for CID: %s\n", cid)
 				return
 			}
+		} else if !n.canServe(entry, cid, token, conn.RemotePeer()) {
+			return
+		}
 
-			fileData, err := os.ReadFile(path)
-			if err != nil {
-				log.Printf("failed to read file: %s\n", err)
-				return
-			}
+		release, err := n.admit(conn.RemotePeer())
+		if err != nil {
+			return
+		}
+		defer release()
 
-			_, err = stream.Write(fileData)
-			if err != nil {
-				log.Printf("error writing file to stream: %s\n", err)
-			} else {
-				log.Printf("file sent successfully for CID: %s\n", cid)
-			}
+		f, err := os.Open(path)
+		if err != nil {
+			log.Printf("failed to read file: %s\n", err)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			log.Printf("failed to read file: %s\n", err)
+			return
+		}
+
+		// padded files are sent zero filled, the transfer only reveals the
+		// padded size
+		content := paddedContent(f, info.Size(), padded)
+		_, err = io.Copy(n.throttle.Writer(n.ctx, stream, conn.RemotePeer().String(), throttle.Interactive), content)
+		if err != nil {
+			log.Printf("error writing file to stream: %s\n", err)
+		} else {
+			log.Printf("file sent successfully for CID: %s\n", cid)
 		}
 	}
 }
 
+// canServe checks that remote may read entry, private files need the peer
+// to be authorized or to present a capability token for cid.
+func (n *Network) canServe(entry storage.FileEntry, cid, token string, remote peer.ID) bool {
+	if entry.Visibility != storage.Private || n.isAuthorized(remote) {
+		return true
+	}
+
+	if token == "" {
+		log.Printf("refusing private CID: %s to unauthorized peer: %s\n", cid, remote)
+		return false
+	}
+	if err := n.VerifyToken(token, cid, remote); err != nil {
+		log.Printf("refusing private CID: %s to peer: %s, error: %v\n", cid, remote, err)
+		return false
+	}
+	return true
+}
+
 func (n *Network) Shutdown() error {
 	log.Println("Shutting down host...")
 	return n.GetHost().Close()
@@ -0,0 +1,284 @@
+package networking
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/gokul656/obscure-fs/internal/pinset"
+	"github.com/gokul656/obscure-fs/internal/storage"
+	"github.com/gokul656/obscure-fs/internal/throttle"
+	"github.com/gokul656/obscure-fs/utils"
+	"github.com/ipfs/go-cid"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// clusterUploader marks entries fetched to hold a copy of a cluster pin.
+const clusterUploader = "cluster"
+
+// PinSync carries pins on the pins topic, either the whole set of a node or
+// the ones it just changed.
+type PinSync struct {
+	Pins []pinset.Pin `json:"pins"`
+}
+
+func (n *Network) Pins() *pinset.Set {
+	return n.pins
+}
+
+// StartClusterPins keeps pins in sync with the rest of the cluster. Every
+// node publishes its whole pin set to peers joining the topic and every
+// interval, so that nodes which missed an update converge anyway, even on
+// pins whose author left. Pins are signed by their author and only merged
+// when the signature holds, whichever node passed them on. After each
+// change, and every interval, the pins this node is picked to hold are
+// fetched.
+func (n *Network) StartClusterPins(ctx context.Context, pins *pinset.Set, interval time.Duration) error {
+	pins.SignWith(n.host.Peerstore().PrivKey(n.host.ID()).Sign)
+	n.pins = pins
+	topic, err := n.joinTopic(utils.PinsTopic)
+	if err != nil {
+		return err
+	}
+
+	sub, err := topic.Subscribe()
+	if err != nil {
+		return err
+	}
+
+	events, err := topic.EventHandler()
+	if err != nil {
+		return err
+	}
+
+	changed := make(chan struct{}, 1)
+	wake := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+	n.pinsChanged = wake
+
+	go func() {
+		for {
+			msg, err := sub.Next(ctx)
+			if err != nil {
+				return
+			}
+			if msg.ReceivedFrom == n.host.ID() {
+				continue
+			}
+
+			var sync PinSync
+			if err := json.Unmarshal(msg.Data, &sync); err != nil {
+				log.Printf("malformed pin set from peer: %s\n", msg.ReceivedFrom)
+				continue
+			}
+
+			valid := sync.Pins[:0]
+			for _, p := range sync.Pins {
+				if err := n.verifyPin(p); err != nil {
+					log.Printf("dropped pin of CID: %s from peer: %s, error: %v\n", p.CID, msg.GetFrom(), err)
+					continue
+				}
+				// the CID names the file on disk
+				if _, err := cid.Decode(p.CID); err == nil {
+					valid = append(valid, p)
+				}
+			}
+
+			merged, err := pins.Merge(valid)
+			if err != nil {
+				log.Printf("failed to merge pin set from peer: %s, error: %v\n", msg.GetFrom(), err)
+				continue
+			}
+			if len(merged) > 0 {
+				log.Printf("merged %d pins from peer: %s\n", len(merged), msg.GetFrom())
+				wake()
+			}
+		}
+	}()
+
+	go func() {
+		for {
+			event, err := events.NextPeerEvent(ctx)
+			if err != nil {
+				return
+			}
+			if event.Type == pubsub.PeerJoin {
+				n.publishPins(pins.All())
+			}
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				n.publishPins(pins.All())
+			case <-changed:
+			}
+			n.syncPins(ctx)
+		}
+	}()
+
+	return nil
+}
+
+// PinCluster adds or updates p in the cluster pin set.
+func (n *Network) PinCluster(p pinset.Pin) (pinset.Pin, error) {
+	if _, err := cid.Decode(p.CID); err != nil {
+		return p, fmt.Errorf("invalid CID: %q", p.CID)
+	}
+	p.Pinned = true
+	p.Replicas = max(p.Replicas, 1)
+	return n.updatePin(p)
+}
+
+// UnpinCluster removes cid from the cluster pin set. Its copies are left to
+// garbage collection.
+func (n *Network) UnpinCluster(cid string) (pinset.Pin, error) {
+	if _, ok := n.pins.Get(cid); !ok {
+		return pinset.Pin{}, fmt.Errorf("CID: %s is not pinned", cid)
+	}
+	return n.updatePin(pinset.Pin{CID: cid})
+}
+
+func (n *Network) updatePin(p pinset.Pin) (pinset.Pin, error) {
+	p.Author = n.host.ID().String()
+	p, err := n.pins.Update(p)
+	if err != nil {
+		return p, err
+	}
+
+	n.publishPins([]pinset.Pin{p})
+	if n.pinsChanged != nil {
+		n.pinsChanged()
+	}
+	return p, nil
+}
+
+// verifyPin checks that the author of p signed it.
+func (n *Network) verifyPin(p pinset.Pin) error {
+	author, err := peer.Decode(p.Author)
+	if err != nil {
+		return fmt.Errorf("invalid author: %q", p.Author)
+	}
+	// keys too large to be inlined in the peer ID are known once connected
+	key, err := author.ExtractPublicKey()
+	if err != nil {
+		key = n.host.Peerstore().PubKey(author)
+	}
+	if key == nil {
+		return fmt.Errorf("unknown key of author: %s", author)
+	}
+
+	if ok, err := key.Verify(p.Payload(), p.Signature); err != nil || !ok {
+		return fmt.Errorf("invalid signature of author: %s", author)
+	}
+	return nil
+}
+
+func (n *Network) publishPins(pins []pinset.Pin) {
+	topic, err := n.joinTopic(utils.PinsTopic)
+	if err != nil {
+		return
+	}
+
+	data, err := json.Marshal(PinSync{Pins: pins})
+	if err != nil {
+		return
+	}
+	if err := topic.Publish(n.ctx, data); err != nil {
+		log.Printf("failed to publish pin set: %v\n", err)
+	}
+}
+
+// syncPins fetches the active pins that the placement strategy picks this
+// node for and that it does not hold yet. Fetches are background transfers,
+// outside the background windows they wait for a later sync.
+func (n *Network) syncPins(ctx context.Context) {
+	if n.profile.Role == RoleGateway || !n.throttle.InWindow(time.Now()) {
+		return
+	}
+
+	for _, p := range n.pins.Active(time.Now()) {
+		if _, err := n.fileStore.GetEntry(p.CID); err == nil || !n.pickedFor(p) {
+			continue
+		}
+		if err := n.fetchPinned(ctx, p); err != nil {
+			log.Printf("failed to fetch pinned CID: %s, error: %v\n", p.CID, err)
+		}
+	}
+}
+
+// pickedFor reports whether this node ranks among the first p.Replicas
+// storage nodes for p. Every node ranks the same peers, so the nodes agree
+// on the holders without coordinating.
+func (n *Network) pickedFor(p pinset.Pin) bool {
+	candidates := append(n.storagePeers(nil), n.selfCandidate())
+	ranked := n.placement.Rank(p.CID, candidates, nil)
+	self := n.host.ID().String()
+	for _, c := range ranked[:min(p.Replicas, len(ranked))] {
+		if c.ID == self {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchPinned retrieves a copy of p from the network and stores it like a
+// pushed replica, unpinned so that it goes once the cluster pin does.
+func (n *Network) fetchPinned(ctx context.Context, p pinset.Pin) error {
+	stat, err := n.StatFile(ctx, p.CID, "")
+	if err != nil {
+		return err
+	}
+	if err := n.fileStore.CheckQuota(clusterUploader, 0, stat.Size); err != nil {
+		return err
+	}
+
+	tmp, err := replicaTemp(p.CID)
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	if err := n.retrieve(ctx, p.CID, tmp.Name(), "", throttle.Background); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	path, err := placeReplica(tmp.Name(), p.CID)
+	if err != nil {
+		return err
+	}
+
+	entry := storage.FileEntry{
+		Visibility: stat.Visibility,
+		Name:       stat.Name,
+		MIME:       stat.MIME,
+		Tags:       stat.Tags,
+		UploadedAt: stat.UploadedAt,
+		Uploader:   clusterUploader,
+		Codec:      storage.CodecInfo{Padding: stat.Padding},
+	}
+	if p.Name != "" {
+		entry.Name = p.Name
+	}
+	if _, err := n.ShareFile(ctx, path, entry, 0); err != nil {
+		n.discardReplica(p.CID, path)
+		return err
+	}
+
+	log.Printf("holding a copy of pinned CID: %s\n", p.CID)
+	return nil
+}
@@ -0,0 +1,99 @@
+package networking
+
+import (
+	"slices"
+
+	"github.com/gokul656/obscure-fs/internal/placement"
+	"github.com/gokul656/obscure-fs/utils"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// PlacementReport shows where the placement strategy wants the copies of a
+// file and where they are.
+type PlacementReport struct {
+	CID      string `json:"cid"`
+	Strategy string `json:"strategy"`
+	Factor   int    `json:"factor"`
+	// Targets are the peers the strategy picks for the copies besides this
+	// node, Candidates every peer it considered in order of preference.
+	Targets    []placement.Candidate `json:"targets"`
+	Candidates []placement.Candidate `json:"candidates"`
+	Holders    []string              `json:"holders"`
+}
+
+func (n *Network) Placement(cid string) PlacementReport {
+	report := PlacementReport{CID: cid, Strategy: n.placement.String(), Factor: max(n.replication.Factor, 1), Holders: []string{}}
+	var size int64
+	if entry, err := n.fileStore.GetEntry(cid); err == nil {
+		report.Factor = max(entry.Replicas, 1)
+		size = entry.DiskSize()
+		if entry.Holders != nil {
+			report.Holders = entry.Holders
+		}
+	}
+
+	report.Candidates = n.rankCandidates(cid, size, nil)
+	report.Targets = report.Candidates[:min(report.Factor-1, len(report.Candidates))]
+	return report
+}
+
+// rankCandidates orders the connected peers that accept replicas and have
+// room for size bytes by the placement strategy, leaving out exclude. The
+// zones of this node and of the excluded peers, which already hold copies,
+// are spread away from.
+func (n *Network) rankCandidates(cid string, size int64, exclude map[peer.ID]bool) []placement.Candidate {
+	zones := []string{n.profile.Zone}
+	for id := range exclude {
+		zones = append(zones, n.candidate(id).Zone)
+	}
+	candidates := slices.DeleteFunc(n.storagePeers(exclude), func(c placement.Candidate) bool {
+		return !c.Admits(size)
+	})
+	return n.placement.Rank(cid, candidates, zones)
+}
+
+// storagePeers describes the connected peers that accept replicas, leaving
+// out exclude and the peers flagged for failing a storage proof.
+func (n *Network) storagePeers(exclude map[peer.ID]bool) []placement.Candidate {
+	candidates := []placement.Candidate{}
+	for _, id := range n.host.Network().Peers() {
+		if exclude[id] || n.flagged(id) {
+			continue
+		}
+		protocols, err := n.host.Peerstore().SupportsProtocols(id, utils.ReplicaProtocolID)
+		if err != nil || len(protocols) == 0 {
+			continue
+		}
+		candidates = append(candidates, n.candidate(id))
+	}
+	return candidates
+}
+
+// selfCandidate describes this node the way it advertises itself.
+func (n *Network) selfCandidate() placement.Candidate {
+	c := placement.Candidate{ID: n.host.ID().String(), Zone: n.profile.Zone, Capacity: n.profile.Capacity}
+	if c.Capacity > 0 {
+		used, _ := n.fileStore.Usage("")
+		c.Free = max(c.Capacity-used, 0)
+	}
+	return c
+}
+
+// candidate describes id with what it advertised, peers missing from the
+// registry are placed without zone or capacity.
+func (n *Network) candidate(id peer.ID) placement.Candidate {
+	c := placement.Candidate{ID: id.String()}
+	if n.registry == nil {
+		return c
+	}
+	if node, ok := n.registry.GetNode(id.String()); ok {
+		c.Zone = node.Zone
+		c.Capacity = node.Capacity
+		c.Free = node.Free
+	}
+	return c
+}
+
+func (n *Network) flagged(id peer.ID) bool {
+	return n.registry != nil && n.registry.IsFlagged(id.String())
+}
@@ -0,0 +1,282 @@
+package networking
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/gokul656/obscure-fs/internal/storage"
+	"github.com/gokul656/obscure-fs/utils"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	proofTimeout = 30 * time.Second
+	// proofRanges ranges of proofRangeSize bytes, or of the whole file when
+	// it is smaller, are asked for in each challenge. Provers refuse more
+	// than maxProofRanges, longer than maxProofRangeSize or shorter than
+	// proofRangeSize, so that short ranges cannot be brute-forced into the
+	// content.
+	proofRanges       = 8
+	proofRangeSize    = 4096
+	maxProofRanges    = 64
+	maxProofRangeSize = 64 << 10
+	proofNonceSize    = 32
+)
+
+var ErrProofFailed = errors.New("storage proof failed")
+
+// ByteRange is a slice of a stored file, in bytes.
+type ByteRange struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// proofChallenge asks for the hash of each range prefixed with the nonce and
+// the prover's peer ID, so answers cannot be computed ahead of time, replayed
+// or relayed from another holder.
+type proofChallenge struct {
+	CID    string      `json:"cid"`
+	Nonce  []byte      `json:"nonce"`
+	Ranges []ByteRange `json:"ranges"`
+}
+
+type proofResponse struct {
+	Hashes []string `json:"hashes,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// ProofResult is the outcome of challenging a holder of a file.
+type ProofResult struct {
+	CID    string        `json:"cid"`
+	Peer   string        `json:"peer"`
+	Passed bool          `json:"passed"`
+	Error  string        `json:"error,omitempty"`
+	Took   time.Duration `json:"took"`
+}
+
+// StartProofProtocol answers storage challenges for the files this node
+// stores.
+func (n *Network) StartProofProtocol() {
+	n.host.SetStreamHandler(utils.ProofProtocolID, n.proofHandler)
+}
+
+// StartProofChallenges challenges the holders of every file this node has a
+// copy of each interval, and the peers flagged for failing one of them.
+func (n *Network) StartProofChallenges(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for cid := range n.fileStore.ListFiles() {
+				n.VerifyHolders(ctx, cid)
+			}
+		}
+	}
+}
+
+// VerifyHolders challenges every known holder of cid against the local copy.
+// Holders that fail are flagged in the registry and forgotten, so that
+// repair replaces their copies. Holders that cannot be reached are left to
+// repair as well, they are not flagged. Peers flagged for failing cid are
+// challenged again, passing lifts what they failed and makes them holders
+// again.
+func (n *Network) VerifyHolders(ctx context.Context, cid string) ([]ProofResult, error) {
+	entry, err := n.fileStore.GetEntry(cid)
+	if err != nil {
+		return nil, err
+	}
+
+	challenged := slices.Clone(entry.Holders)
+	var retried []string
+	if n.registry != nil {
+		for _, h := range n.registry.FailedProofs(cid) {
+			if !slices.Contains(challenged, h) {
+				challenged = append(challenged, h)
+				retried = append(retried, h)
+			}
+		}
+	}
+
+	results := []ProofResult{}
+	var failed []string
+	for _, h := range challenged {
+		id, err := peer.Decode(h)
+		if err != nil || id == n.host.ID() {
+			continue
+		}
+
+		started := time.Now()
+		err = n.Challenge(ctx, id, cid, entry)
+		result := ProofResult{CID: cid, Peer: h, Passed: err == nil, Took: time.Since(started)}
+		switch {
+		case err == nil:
+			if n.registry != nil && n.registry.PassedProof(h, cid) {
+				log.Printf("peer: %s passed the storage proof of CID: %s, lifting its flag\n", h, cid)
+			}
+			if slices.Contains(retried, h) {
+				n.fileStore.AddHolders(cid, h)
+			}
+		case errors.Is(err, ErrProofFailed):
+			log.Printf("peer: %s failed the storage proof of CID: %s, error: %v\n", h, cid, err)
+			result.Error = err.Error()
+			failed = append(failed, h)
+			if n.registry != nil {
+				n.registry.Flag(h, cid)
+			}
+		default:
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+
+	if len(failed) > 0 {
+		entry, _ = n.fileStore.GetEntry(cid)
+		n.fileStore.SetHolders(cid, slices.DeleteFunc(slices.Clone(entry.Holders), func(h string) bool {
+			return slices.Contains(failed, h)
+		}))
+	}
+	return results, nil
+}
+
+// Challenge asks id for the hashes of random ranges of cid and checks them
+// against entry, the local copy. Wrong or missing answers wrap
+// ErrProofFailed, other errors mean id could not be asked.
+func (n *Network) Challenge(ctx context.Context, id peer.ID, cid string, entry storage.FileEntry) error {
+	challenge := proofChallenge{CID: cid, Nonce: make([]byte, proofNonceSize)}
+	if _, err := rand.Read(challenge.Nonce); err != nil {
+		return err
+	}
+	length := min(proofRangeSize, entry.Size)
+	for i := 0; i < proofRanges && entry.Size > 0; i++ {
+		offset, err := rand.Int(rand.Reader, big.NewInt(entry.Size-length+1))
+		if err != nil {
+			return err
+		}
+		challenge.Ranges = append(challenge.Ranges, ByteRange{Offset: offset.Int64(), Length: length})
+	}
+
+	expected, err := proveRanges(entry.Path, challenge.Nonce, id, challenge.Ranges)
+	if err != nil {
+		return err
+	}
+
+	stream, err := n.host.NewStream(ctx, id, utils.ProofProtocolID)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	stream.SetDeadline(time.Now().Add(proofTimeout))
+
+	if err := json.NewEncoder(stream).Encode(challenge); err != nil {
+		return err
+	}
+	var response proofResponse
+	if err := json.NewDecoder(stream).Decode(&response); err != nil {
+		return err
+	}
+
+	if response.Error != "" {
+		return fmt.Errorf("%w: %s", ErrProofFailed, response.Error)
+	}
+	if !slices.Equal(response.Hashes, expected) {
+		return fmt.Errorf("%w: wrong hashes", ErrProofFailed)
+	}
+	return nil
+}
+
+func (n *Network) proofHandler(stream network.Stream) {
+	defer stream.Close()
+	stream.SetDeadline(time.Now().Add(proofTimeout))
+
+	conn := stream.Conn()
+	if n.gater != nil && !n.gater.Allowed(conn.RemotePeer(), conn.RemoteMultiaddr()) {
+		log.Printf("gater: rejected storage challenge from peer: %s at: %s\n", conn.RemotePeer(), conn.RemoteMultiaddr())
+		stream.Reset()
+		return
+	}
+
+	encoder := json.NewEncoder(stream)
+	var challenge proofChallenge
+	if err := json.NewDecoder(stream).Decode(&challenge); err != nil {
+		encoder.Encode(proofResponse{Error: "malformed challenge"})
+		return
+	}
+	if _, err := cid.Decode(challenge.CID); err != nil {
+		encoder.Encode(proofResponse{Error: fmt.Sprintf("invalid CID: %q", challenge.CID)})
+		return
+	}
+	if len(challenge.Ranges) > maxProofRanges {
+		encoder.Encode(proofResponse{Error: "too many ranges"})
+		return
+	}
+
+	// challengers that may not know of the file are told it is not stored
+	entry, err := n.fileStore.GetEntry(challenge.CID)
+	if err != nil || !n.mayChallenge(entry, challenge.CID, conn.RemotePeer()) {
+		encoder.Encode(proofResponse{Error: fmt.Sprintf("CID: %s is not stored", challenge.CID)})
+		return
+	}
+	minLength := min(proofRangeSize, entry.Size)
+	for _, r := range challenge.Ranges {
+		if r.Offset < 0 || r.Length < minLength || r.Length > maxProofRangeSize || r.Offset+r.Length > entry.Size {
+			encoder.Encode(proofResponse{Error: "invalid range"})
+			return
+		}
+	}
+
+	hashes, err := proveRanges(entry.Path, challenge.Nonce, n.host.ID(), challenge.Ranges)
+	if err != nil {
+		log.Printf("failed to answer storage challenge for CID: %s, error: %v\n", challenge.CID, err)
+		encoder.Encode(proofResponse{Error: "failed to read content"})
+		return
+	}
+	encoder.Encode(proofResponse{Hashes: hashes})
+}
+
+// mayChallenge reports whether remote may challenge this node for cid: a
+// holder of it, the peer that pushed the copy, or a peer it may be served to.
+func (n *Network) mayChallenge(entry storage.FileEntry, cid string, remote peer.ID) bool {
+	if slices.Contains(entry.Holders, remote.String()) || entry.Uploader == replicaUploaderPrefix+remote.String() {
+		return true
+	}
+	return n.canServe(entry, cid, "", remote)
+}
+
+// proveRanges hashes each range of the file at path prefixed with nonce and
+// prover, the peer answering the challenge.
+func proveRanges(path string, nonce []byte, prover peer.ID, ranges []ByteRange) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hashes := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		h := sha256.New()
+		h.Write(nonce)
+		h.Write([]byte(prover))
+		if _, err := io.Copy(h, io.NewSectionReader(f, r.Offset, r.Length)); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hex.EncodeToString(h.Sum(nil)))
+	}
+	return hashes, nil
+}
@@ -2,6 +2,7 @@ package networking
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"log"
@@ -12,12 +13,16 @@ import (
 	"github.com/libp2p/go-libp2p/core/protocol"
 )
 
-func (n *Network) RequestFile(peerID peer.ID, protocolID protocol.ID, cid string) error {
-	stream, err := n.host.NewStream(n.ctx, peerID, protocolID)
+func (n *Network) RequestFile(ctx context.Context, peerID peer.ID, protocolID protocol.ID, cid string) error {
+	ctx, cancel := withTimeout(ctx, n.timeouts.Transfer)
+	defer cancel()
+
+	stream, err := n.host.NewStream(ctx, peerID, protocolID)
 	if err != nil {
 		return fmt.Errorf("failed to create stream: %w", err)
 	}
 	defer stream.Close()
+	defer bindStream(ctx, stream)()
 
 	_, err = stream.Write([]byte(fmt.Sprintf("REQ:%s\n", cid)))
 	if err != nil {
@@ -0,0 +1,241 @@
+package networking
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gokul656/obscure-fs/internal/throttle"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+var ErrRebalanceRunning = errors.New("a rebalance is already running")
+
+// Move copies a file to a peer the placement strategy prefers, and then
+// drops the copy of a holder it no longer picks.
+type Move struct {
+	CID  string `json:"cid"`
+	To   string `json:"to"`
+	From string `json:"from,omitempty"`
+	Size int64  `json:"size"`
+}
+
+// RebalanceStatus reports the progress of the current or last rebalance.
+type RebalanceStatus struct {
+	Running      bool      `json:"running"`
+	StartedAt    time.Time `json:"started_at,omitempty"`
+	FinishedAt   time.Time `json:"finished_at,omitempty"`
+	Planned      int       `json:"planned"`
+	Completed    int       `json:"completed"`
+	Failed       int       `json:"failed"`
+	BytesPlanned int64     `json:"bytes_planned"`
+	BytesMoved   int64     `json:"bytes_moved"`
+	// Bandwidth is the budget in bytes per second, 0 means unlimited.
+	Bandwidth int64             `json:"bandwidth"`
+	Current   *Move             `json:"current,omitempty"`
+	Errors    map[string]string `json:"errors,omitempty"`
+}
+
+type rebalancer struct {
+	mu     sync.Mutex
+	status RebalanceStatus
+	// budget meters the pushes of moves, nil when unlimited.
+	budget *throttle.Throttler
+}
+
+func newRebalancer(bandwidth int64) *rebalancer {
+	r := &rebalancer{}
+	if bandwidth > 0 {
+		r.budget = throttle.New(throttle.Limits{Upload: bandwidth}, nil)
+	}
+	return r
+}
+
+func (n *Network) RebalanceStatus() RebalanceStatus {
+	n.rebalancer.mu.Lock()
+	defer n.rebalancer.mu.Unlock()
+
+	status := n.rebalancer.status
+	status.Bandwidth = n.rebalanceBandwidth
+	if status.Current != nil {
+		current := *status.Current
+		status.Current = &current
+	}
+	return status
+}
+
+// StartRebalancer rebalances every interval.
+func (n *Network) StartRebalancer(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := n.Rebalance(ctx); err != nil && !errors.Is(err, ErrRebalanceRunning) {
+				log.Printf("rebalance failed: %v\n", err)
+			}
+		}
+	}
+}
+
+// Rebalance moves the copies of files uploaded to this node towards the
+// peers the placement strategy picks now, one file at a time and metered to
+// stay within the bandwidth budget. This node keeps its own copy. It blocks
+// until every move was tried.
+func (n *Network) Rebalance(ctx context.Context) error {
+	r := n.rebalancer
+	r.mu.Lock()
+	if r.status.Running {
+		r.mu.Unlock()
+		return ErrRebalanceRunning
+	}
+	r.status = RebalanceStatus{Running: true, StartedAt: time.Now().UTC(), Errors: make(map[string]string)}
+	r.mu.Unlock()
+
+	moves := n.planRebalance()
+	r.mu.Lock()
+	r.status.Planned = len(moves)
+	for _, m := range moves {
+		r.status.BytesPlanned += m.Size
+	}
+	r.mu.Unlock()
+	if len(moves) > 0 {
+		log.Printf("rebalance: %d moves planned\n", len(moves))
+	}
+
+	defer func() {
+		r.mu.Lock()
+		r.status.Running = false
+		r.status.Current = nil
+		r.status.FinishedAt = time.Now().UTC()
+		r.mu.Unlock()
+	}()
+
+	for _, m := range moves {
+		r.mu.Lock()
+		r.status.Current = &m
+		r.mu.Unlock()
+
+		sent, err := n.move(ctx, m)
+
+		r.mu.Lock()
+		// a failed move may have sent part of the file already
+		r.status.BytesMoved += sent
+		if err != nil {
+			log.Printf("rebalance: failed to move CID: %s to peer: %s, error: %v\n", m.CID, m.To, err)
+			r.status.Failed++
+			r.status.Errors[m.CID] = err.Error()
+		} else {
+			r.status.Completed++
+		}
+		r.mu.Unlock()
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// planRebalance compares the holders of each replicated file with the
+// targets of the placement strategy. Only the node a file was uploaded to
+// plans its moves, copies pushed by peers are left to their origin.
+func (n *Network) planRebalance() []Move {
+	var moves []Move
+	for cid, entry := range n.fileStore.ListFiles() {
+		if entry.Replicas <= 1 || strings.HasPrefix(entry.Uploader, replicaUploaderPrefix) || !n.replicates(entry) {
+			continue
+		}
+
+		var holders []peer.ID
+		for _, h := range entry.Holders {
+			id, err := peer.Decode(h)
+			if err == nil && n.host.Network().Connectedness(id) == network.Connected {
+				holders = append(holders, id)
+			}
+		}
+
+		// holders already made room for their copy, other peers must
+		// have room for one
+		candidates := n.rankCandidates(cid, 0, nil)
+		var targets []string
+		for _, c := range candidates {
+			if len(targets) == entry.Replicas-1 {
+				break
+			}
+			if c.Admits(entry.DiskSize()) || slices.Contains(entry.Holders, c.ID) {
+				targets = append(targets, c.ID)
+			}
+		}
+
+		var surplus []string
+		for _, id := range holders {
+			if !slices.Contains(targets, id.String()) {
+				surplus = append(surplus, id.String())
+			}
+		}
+
+		held := len(entry.Holders)
+		for _, to := range targets {
+			if slices.Contains(entry.Holders, to) {
+				continue
+			}
+
+			move := Move{CID: cid, To: to, Size: entry.PublicSize()}
+			if len(surplus) > 0 {
+				move.From, surplus = surplus[0], surplus[1:]
+			} else if held >= entry.Replicas-1 {
+				// enough copies already, only swaps are worth the traffic
+				continue
+			} else {
+				held++
+			}
+			moves = append(moves, move)
+		}
+	}
+	return moves
+}
+
+// move pushes m.CID to m.To and drops the copy held by m.From, if any. It
+// returns the bytes sent, which are none when m.To already had a copy.
+func (n *Network) move(ctx context.Context, m Move) (int64, error) {
+	entry, err := n.fileStore.GetEntry(m.CID)
+	if err != nil {
+		return 0, err
+	}
+
+	to, err := peer.Decode(m.To)
+	if err != nil {
+		return 0, err
+	}
+	sent, err := n.pushReplica(ctx, to, m.CID, entry, throttle.Background, n.rebalancer.budget)
+	if err != nil {
+		return sent, err
+	}
+	n.fileStore.AddHolders(m.CID, m.To)
+	// the new holder is known even when the rebalance is cancelled now
+	defer n.shareHolders(n.ctx, m.CID)
+
+	if m.From == "" {
+		return sent, nil
+	}
+	from, err := peer.Decode(m.From)
+	if err != nil {
+		return sent, err
+	}
+	if err := n.dropReplica(ctx, from, m.CID); err != nil {
+		return sent, err
+	}
+
+	entry, _ = n.fileStore.GetEntry(m.CID)
+	n.fileStore.SetHolders(m.CID, slices.DeleteFunc(slices.Clone(entry.Holders), func(h string) bool { return h == m.From }))
+	return sent, nil
+}
@@ -0,0 +1,171 @@
+package networking
+
+import (
+	"context"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gokul656/obscure-fs/internal/storage"
+	"github.com/gokul656/obscure-fs/internal/throttle"
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// unreachablePeers records since when peers have been disconnected, from
+// the connectedness events of the host.
+type unreachablePeers struct {
+	mu    sync.Mutex
+	since map[peer.ID]time.Time
+}
+
+func (u *unreachablePeers) set(id peer.ID, connected bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if connected {
+		delete(u.since, id)
+	} else if _, ok := u.since[id]; !ok {
+		u.since[id] = time.Now()
+	}
+}
+
+// downFor returns how long id has been unreachable, a peer not known to be
+// down yet starts counting now.
+func (u *unreachablePeers) downFor(id peer.ID) time.Duration {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	since, ok := u.since[id]
+	if !ok {
+		since = time.Now()
+		u.since[id] = since
+	}
+	return time.Since(since)
+}
+
+// StartReplicaRepair checks every interval that replicated files are still
+// held by as many nodes as their replication factor asks for, and pushes new
+// copies when holders have been unreachable for offlineAfter.
+func (n *Network) StartReplicaRepair(ctx context.Context, interval, offlineAfter time.Duration) {
+	sub, err := n.host.EventBus().Subscribe(new(event.EvtPeerConnectednessChanged))
+	if err != nil {
+		log.Printf("failed to watch peer connectivity: %v\n", err)
+		return
+	}
+	defer sub.Close()
+
+	unreachable := &unreachablePeers{since: make(map[peer.ID]time.Time)}
+	go func() {
+		for e := range sub.Out() {
+			evt := e.(event.EvtPeerConnectednessChanged)
+			unreachable.set(evt.Peer, evt.Connectedness == network.Connected)
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for cid, entry := range n.fileStore.ListFiles() {
+				if entry.Replicas > 1 {
+					n.repairReplicas(ctx, cid, entry, unreachable, offlineAfter)
+				}
+			}
+		}
+	}
+}
+
+func (n *Network) repairReplicas(ctx context.Context, cid string, entry storage.FileEntry, unreachable *unreachablePeers, offlineAfter time.Duration) {
+	var live []peer.ID
+	for _, id := range n.replicaHolders(ctx, cid, entry) {
+		if n.host.Network().Connectedness(id) == network.Connected {
+			unreachable.set(id, true)
+			live = append(live, id)
+			continue
+		}
+
+		// a reconnect shows up as an event, no need to wait for it
+		n.redial(id)
+		// a holder that just dropped off keeps its copy counted for a while
+		if unreachable.downFor(id) < offlineAfter {
+			live = append(live, id)
+		}
+	}
+
+	missing := entry.Replicas - 1 - len(live)
+	if missing <= 0 || !n.leadsRepair(live) {
+		return
+	}
+
+	log.Printf("CID: %s has %d of %d copies, replicating to %d more peers\n", cid, len(live)+1, entry.Replicas, missing)
+	holders := make([]string, 0, len(live))
+	exclude := make(map[peer.ID]bool, len(live))
+	for _, id := range live {
+		holders = append(holders, id.String())
+		exclude[id] = true
+	}
+	// holders that went offline are forgotten, their copies are replaced
+	n.fileStore.SetHolders(cid, holders)
+
+	peers, _ := n.pushReplicas(ctx, cid, entry, missing, missing, exclude, throttle.Background)
+	if len(peers) < missing {
+		log.Printf("CID: %s is still short of %d copies\n", cid, missing-len(peers))
+	}
+}
+
+// replicaHolders returns the other peers known to hold cid, from the entry
+// and, for advertised files, from the DHT providers that still answer for
+// it. Peers flagged for failing a storage proof do not count.
+func (n *Network) replicaHolders(ctx context.Context, cid string, entry storage.FileEntry) []peer.ID {
+	var holders []peer.ID
+	add := func(id peer.ID) {
+		if id != n.host.ID() && !n.flagged(id) && !slices.Contains(holders, id) {
+			holders = append(holders, id)
+		}
+	}
+
+	for _, h := range entry.Holders {
+		if id, err := peer.Decode(h); err == nil {
+			add(id)
+		}
+	}
+	if entry.Visibility != storage.Private {
+		providers, _ := n.FindFile(ctx, cid)
+		for _, p := range providers {
+			if p.ID == n.host.ID() || slices.Contains(holders, p.ID) {
+				continue
+			}
+			// provider records outlive copies that were dropped or deleted
+			if _, err := n.statFromPeer(ctx, p.ID, cid, ""); err == nil {
+				add(p.ID)
+			}
+		}
+	}
+	return holders
+}
+
+// redial tries to connect to id in the background.
+func (n *Network) redial(id peer.ID) {
+	go func() {
+		ctx, cancel := withTimeout(n.ctx, n.timeouts.Request)
+		defer cancel()
+		n.host.Connect(ctx, peer.AddrInfo{ID: id})
+	}()
+}
+
+// leadsRepair elects the holder with the lowest peer ID among live and this
+// node, so that holders of the same file do not all push copies at once.
+// Holders agree on the election since they are told about each other.
+func (n *Network) leadsRepair(live []peer.ID) bool {
+	for _, id := range live {
+		if id < n.host.ID() {
+			return false
+		}
+	}
+	return true
+}
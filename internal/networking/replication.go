@@ -0,0 +1,539 @@
+package networking
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gokul656/obscure-fs/internal/hashing"
+	"github.com/gokul656/obscure-fs/internal/storage"
+	"github.com/gokul656/obscure-fs/internal/throttle"
+	"github.com/gokul656/obscure-fs/utils"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	replicaHave     = "have"
+	replicaSend     = "send"
+	replicaStored   = "stored"
+	replicaRejected = "rejected"
+	replicaDropped  = "dropped"
+	replicaUpdated  = "updated"
+)
+
+// replicaUploaderPrefix marks entries stored as a copy pushed by a peer.
+const replicaUploaderPrefix = "peer "
+
+var ErrQuorumNotReached = errors.New("replication quorum not reached")
+
+// ReplicationPolicy sets how many nodes hold a file, this one included, and
+// how many of them must acknowledge a verified copy before an upload
+// succeeds. A Quorum of 0 means a majority of Factor.
+type ReplicationPolicy struct {
+	Factor int `json:"factor"`
+	Quorum int `json:"quorum"`
+}
+
+// RequiredCopies returns the copies an upload needs, clamped to [1, Factor].
+func (p ReplicationPolicy) RequiredCopies() int {
+	factor := max(p.Factor, 1)
+	if p.Quorum <= 0 {
+		return factor/2 + 1
+	}
+	return min(p.Quorum, factor)
+}
+
+type ReplicationResult struct {
+	CID    string            `json:"cid"`
+	Factor int               `json:"factor"`
+	Quorum int               `json:"quorum"`
+	Stored int               `json:"stored"`
+	Peers  []string          `json:"peers"`
+	Failed map[string]string `json:"failed,omitempty"`
+}
+
+// replicaOffer opens a push, the content follows once the receiver asks
+// for it. With Drop set it asks the receiver to give up its copy instead,
+// with Holders it tells the receiver every peer holding a copy.
+type replicaOffer struct {
+	CID     string            `json:"cid"`
+	Entry   storage.FileEntry `json:"entry"`
+	Drop    bool              `json:"drop,omitempty"`
+	Holders []string          `json:"holders,omitempty"`
+}
+
+type replicaReply struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type replicaAck struct {
+	peer peer.ID
+	err  error
+	// done marks a pusher that ran out of candidates.
+	done bool
+}
+
+func (n *Network) ReplicationPolicy() ReplicationPolicy {
+	return n.replication
+}
+
+// StartReplicaProtocol accepts copies pushed by other nodes, gateways do not
+// take any.
+func (n *Network) StartReplicaProtocol() {
+	if n.profile.Role == RoleGateway {
+		return
+	}
+	n.host.SetStreamHandler(utils.ReplicaProtocolID, n.replicaHandler)
+}
+
+// Replicate pushes cid to peers until policy.Factor nodes hold it. It
+// returns once the quorum is reached, the remaining pushes carry on in the
+// background. A caller whose ctx is done stops waiting for the quorum, not
+// the pushes.
+func (n *Network) Replicate(ctx context.Context, cid string, policy ReplicationPolicy) (ReplicationResult, error) {
+	quorum := policy.RequiredCopies()
+	result := ReplicationResult{CID: cid, Factor: max(policy.Factor, 1), Quorum: quorum, Stored: 1, Peers: []string{}}
+
+	entry, err := n.fileStore.GetEntry(cid)
+	if err != nil {
+		return result, err
+	}
+	if !n.replicates(entry) {
+		log.Printf("CID: %s is private and stays on this node\n", cid)
+		result.Factor, result.Quorum = 1, 1
+		return result, nil
+	}
+
+	// the uploader waits for the quorum
+	peers, failed := n.pushReplicas(ctx, cid, entry, result.Factor-1, quorum-1, nil, throttle.Interactive)
+	result.Stored += len(peers)
+	result.Peers = append(result.Peers, peers...)
+	result.Failed = failed
+
+	if result.Stored < quorum && ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+	if result.Stored < quorum {
+		return result, fmt.Errorf("%w: %d of %d copies stored", ErrQuorumNotReached, result.Stored, quorum)
+	}
+	log.Printf("CID: %s replicated to %d of %d nodes\n", cid, result.Stored, result.Factor)
+	return result, nil
+}
+
+// replicates reports whether entry may be pushed to peers. Private files
+// stay on this node unless private replication is enabled, since peers
+// would hold them in plaintext.
+func (n *Network) replicates(entry storage.FileEntry) bool {
+	return entry.Visibility != storage.Private || n.replicatePrivate
+}
+
+// pushReplicas stores cid on count peers outside exclude, trying the next
+// candidate whenever a push fails. It returns once needed pushes succeeded
+// or every candidate was tried or ctx is done, with the peers that
+// acknowledged so far. Every successful push is recorded as a holder of the
+// entry, including the ones finishing after the return. Once every push is
+// done, the holders are told about each other.
+func (n *Network) pushReplicas(ctx context.Context, cid string, entry storage.FileEntry, count, needed int, exclude map[peer.ID]bool, class throttle.Class) ([]string, map[string]string) {
+	peers := []string{}
+	failed := make(map[string]string)
+	if count <= 0 || !n.replicates(entry) {
+		return peers, failed
+	}
+
+	candidates := n.rankCandidates(cid, entry.DiskSize(), exclude)
+	next := make(chan peer.ID, len(candidates))
+	for _, c := range candidates {
+		if id, err := peer.Decode(c.ID); err == nil {
+			next <- id
+		}
+	}
+	close(next)
+
+	// buffered for every attempt, pushes left behind never block
+	acks := make(chan replicaAck, len(candidates)+count)
+	var pushers sync.WaitGroup
+	pushers.Add(count)
+	go func() {
+		pushers.Wait()
+		n.shareHolders(n.ctx, cid)
+	}()
+	for i := 0; i < count; i++ {
+		go func() {
+			defer pushers.Done()
+			for id := range next {
+				// pushes outlive ctx, only the wait for them ends with it
+				_, err := n.pushReplica(n.ctx, id, cid, entry, class, nil)
+				if err == nil {
+					n.fileStore.AddHolders(cid, id.String())
+				}
+				acks <- replicaAck{peer: id, err: err}
+				if err == nil {
+					return
+				}
+			}
+			acks <- replicaAck{done: true}
+		}()
+	}
+
+	for done := 0; len(peers) < needed && done < count; {
+		var ack replicaAck
+		select {
+		case <-ctx.Done():
+			return peers, failed
+		case ack = <-acks:
+		}
+
+		switch {
+		case ack.done:
+			done++
+		case ack.err != nil:
+			log.Printf("failed to replicate CID: %s to peer: %s, error: %v\n", cid, ack.peer, ack.err)
+			failed[ack.peer.String()] = ack.err.Error()
+		default:
+			peers = append(peers, ack.peer.String())
+			// pushers stop after their first success
+			done++
+		}
+	}
+	return peers, failed
+}
+
+// pushReplica offers cid to id and sends the content unless it is already
+// held there. It succeeds once id reports a verified copy, and returns the
+// bytes sent, none when id already held a copy. Background pushes
+// wait for a background window first, the transfer timeout only starts
+// once they have one. The content is also metered by budget when it is not
+// nil.
+func (n *Network) pushReplica(ctx context.Context, id peer.ID, cid string, entry storage.FileEntry, class throttle.Class, budget *throttle.Throttler) (int64, error) {
+	if class == throttle.Background {
+		if err := n.throttle.WaitWindow(ctx); err != nil {
+			return 0, err
+		}
+	}
+
+	ctx, cancel := withTimeout(ctx, n.timeouts.Transfer)
+	defer cancel()
+
+	stream, err := n.host.NewStream(ctx, id, utils.ReplicaProtocolID)
+	if err != nil {
+		return 0, err
+	}
+	defer stream.Close()
+	defer bindStream(ctx, stream)()
+
+	reader := bufio.NewReader(stream)
+	// padded files are offered and sent at their padded size
+	offered := entry
+	offered.Size = entry.PublicSize()
+	reply, err := exchangeReplica(stream, reader, replicaOffer{CID: cid, Entry: offered})
+	if err != nil {
+		return 0, streamErr(ctx, err)
+	}
+
+	switch reply.Status {
+	case replicaHave:
+		return 0, nil
+	case replicaSend:
+	default:
+		return 0, fmt.Errorf("replica rejected: %s", reply.Error)
+	}
+
+	f, err := os.Open(entry.Path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	w := budget.Writer(ctx, n.throttle.Writer(ctx, stream, id.String(), class), id.String(), class)
+	sent, err := io.Copy(w, paddedContent(f, entry.Size, offered.Size))
+	if err != nil {
+		return sent, streamErr(ctx, err)
+	}
+
+	var ack replicaReply
+	if err := json.NewDecoder(reader).Decode(&ack); err != nil {
+		return sent, streamErr(ctx, err)
+	}
+	if ack.Status != replicaStored {
+		return sent, fmt.Errorf("replica rejected: %s", ack.Error)
+	}
+	return sent, nil
+}
+
+// shareHolders sends the holders of cid, this node included, to each of
+// them. Peers only learn of the pushes they receive themselves otherwise,
+// and would each take a missing uploader for a file nobody else holds.
+func (n *Network) shareHolders(ctx context.Context, cid string) {
+	entry, err := n.fileStore.GetEntry(cid)
+	if err != nil || len(entry.Holders) == 0 {
+		return
+	}
+
+	holders := append([]string{n.host.ID().String()}, entry.Holders...)
+	for _, h := range entry.Holders {
+		id, err := peer.Decode(h)
+		if err != nil {
+			continue
+		}
+		if err := n.sendHolders(ctx, id, cid, holders); err != nil {
+			log.Printf("failed to share holders of CID: %s with peer: %s, error: %v\n", cid, id, err)
+		}
+	}
+}
+
+func (n *Network) sendHolders(ctx context.Context, id peer.ID, cid string, holders []string) error {
+	ctx, cancel := withTimeout(ctx, n.timeouts.Request)
+	defer cancel()
+
+	stream, err := n.host.NewStream(ctx, id, utils.ReplicaProtocolID)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	defer bindStream(ctx, stream)()
+
+	reply, err := exchangeReplica(stream, bufio.NewReader(stream), replicaOffer{CID: cid, Holders: holders})
+	if err != nil {
+		return streamErr(ctx, err)
+	}
+	if reply.Status != replicaUpdated {
+		return fmt.Errorf("holders rejected: %s", reply.Error)
+	}
+	return nil
+}
+
+// dropReplica asks id to delete its copy of cid, which it only does for
+// copies pushed by peers that it knows as holders.
+func (n *Network) dropReplica(ctx context.Context, id peer.ID, cid string) error {
+	ctx, cancel := withTimeout(ctx, n.timeouts.Request)
+	defer cancel()
+
+	stream, err := n.host.NewStream(ctx, id, utils.ReplicaProtocolID)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	defer bindStream(ctx, stream)()
+
+	reply, err := exchangeReplica(stream, bufio.NewReader(stream), replicaOffer{CID: cid, Drop: true})
+	if err != nil {
+		return streamErr(ctx, err)
+	}
+	if reply.Status != replicaDropped {
+		return fmt.Errorf("drop rejected: %s", reply.Error)
+	}
+	return nil
+}
+
+func exchangeReplica(w io.Writer, r *bufio.Reader, offer replicaOffer) (replicaReply, error) {
+	var reply replicaReply
+	if err := json.NewEncoder(w).Encode(offer); err != nil {
+		return reply, err
+	}
+
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return reply, err
+	}
+	return reply, json.Unmarshal(line, &reply)
+}
+
+func (n *Network) replicaHandler(stream network.Stream) {
+	defer stream.Close()
+	// a received copy is bounded like the push that sends it
+	if n.timeouts.Transfer > 0 {
+		stream.SetDeadline(time.Now().Add(n.timeouts.Transfer))
+	}
+
+	conn := stream.Conn()
+	if n.gater != nil && !n.gater.Allowed(conn.RemotePeer(), conn.RemoteMultiaddr()) {
+		log.Printf("gater: rejected replica from peer: %s at: %s\n", conn.RemotePeer(), conn.RemoteMultiaddr())
+		stream.Reset()
+		return
+	}
+
+	reader := bufio.NewReader(stream)
+	encoder := json.NewEncoder(stream)
+	reject := func(err error) {
+		log.Printf("rejected replica from peer: %s, error: %v\n", conn.RemotePeer(), err)
+		encoder.Encode(replicaReply{Status: replicaRejected, Error: err.Error()})
+	}
+
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		log.Printf("error reading replica offer: %s\n", err)
+		return
+	}
+	var offer replicaOffer
+	if err := json.Unmarshal(line, &offer); err != nil {
+		reject(fmt.Errorf("malformed offer"))
+		return
+	}
+	// the CID names the file on disk
+	if _, err := cid.Decode(offer.CID); err != nil {
+		reject(fmt.Errorf("invalid CID: %q", offer.CID))
+		return
+	}
+
+	if offer.Drop {
+		if err := n.releaseReplica(offer.CID, conn.RemotePeer()); err != nil {
+			reject(err)
+			return
+		}
+		encoder.Encode(replicaReply{Status: replicaDropped})
+		return
+	}
+
+	if offer.Holders != nil {
+		if err := n.updateHolders(offer.CID, conn.RemotePeer(), offer.Holders); err != nil {
+			reject(err)
+			return
+		}
+		encoder.Encode(replicaReply{Status: replicaUpdated})
+		return
+	}
+
+	if _, err := n.fileStore.GetEntry(offer.CID); err == nil {
+		encoder.Encode(replicaReply{Status: replicaHave})
+		return
+	}
+
+	uploader := replicaUploaderPrefix + conn.RemotePeer().String()
+	if err := n.fileStore.CheckQuota(uploader, 0, offer.Entry.DiskSize()); err != nil {
+		reject(err)
+		return
+	}
+	if err := encoder.Encode(replicaReply{Status: replicaSend}); err != nil {
+		return
+	}
+
+	// nobody on this node waits on a copy pushed by a peer, it is read at
+	// background priority whatever the pusher is in a hurry for
+	path, err := n.receiveReplica(n.throttle.Reader(n.ctx, reader, conn.RemotePeer().String(), throttle.Background), offer)
+	if err != nil {
+		reject(err)
+		return
+	}
+
+	entry := offer.Entry
+	entry.Uploader = uploader
+	entry.Pinned = true
+	entry.Holders = append(entry.Holders, conn.RemotePeer().String())
+	if _, err := n.ShareFile(n.ctx, path, entry, 0); err != nil {
+		n.discardReplica(offer.CID, path)
+		reject(err)
+		return
+	}
+
+	log.Printf("stored replica of CID: %s from peer: %s\n", offer.CID, conn.RemotePeer())
+	encoder.Encode(replicaReply{Status: replicaStored})
+}
+
+// releaseReplica deletes the copy of cid on behalf of remote. Only copies
+// pushed by peers can go, and only at the request of a known holder.
+func (n *Network) releaseReplica(cid string, remote peer.ID) error {
+	entry, err := n.fileStore.GetEntry(cid)
+	if err != nil {
+		return nil
+	}
+	if !strings.HasPrefix(entry.Uploader, replicaUploaderPrefix) {
+		return fmt.Errorf("CID: %s is not a replica", cid)
+	}
+	if !slices.Contains(entry.Holders, remote.String()) {
+		return fmt.Errorf("peer: %s does not hold CID: %s", remote, cid)
+	}
+
+	_, err = n.DeleteFile(cid)
+	return err
+}
+
+// updateHolders replaces the holders of the copy of cid with the ones remote
+// knows of. Only a known holder can tell them.
+func (n *Network) updateHolders(cid string, remote peer.ID, holders []string) error {
+	entry, err := n.fileStore.GetEntry(cid)
+	if err != nil {
+		return fmt.Errorf("CID: %s is not held", cid)
+	}
+	if !slices.Contains(entry.Holders, remote.String()) {
+		return fmt.Errorf("peer: %s does not hold CID: %s", remote, cid)
+	}
+
+	others := []string{}
+	for _, h := range holders {
+		id, err := peer.Decode(h)
+		if err != nil {
+			return fmt.Errorf("invalid holder: %q", h)
+		}
+		if id != n.host.ID() && !slices.Contains(others, h) {
+			others = append(others, h)
+		}
+	}
+	n.fileStore.SetHolders(cid, others)
+	return nil
+}
+
+// receiveReplica reads the content of offer and checks it against its CID.
+func (n *Network) receiveReplica(r io.Reader, offer replicaOffer) (string, error) {
+	f, err := replicaTemp(offer.CID)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.CopyN(f, r, offer.Entry.Size)
+	f.Close()
+	if err == nil {
+		err = hashing.TrimPadding(f.Name(), offer.CID)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return placeReplica(f.Name(), offer.CID)
+}
+
+// replicaTemp creates a file of its own to receive a copy of cid into. A
+// push and a pin fetch of the same CID may run at once.
+func replicaTemp(cid string) (*os.File, error) {
+	if err := os.MkdirAll(utils.ReplicaPath, 0755); err != nil {
+		return nil, err
+	}
+	return os.CreateTemp(utils.ReplicaPath, "."+cid+"-*")
+}
+
+// placeReplica checks the content received at tmp against cid and moves it
+// to the replica path of cid. Copies of the same CID hold the same bytes, so
+// the last one to land may replace another.
+func placeReplica(tmp, cid string) (string, error) {
+	if hash, err := hashing.HashFile(tmp); err != nil || hash != cid {
+		os.Remove(tmp)
+		return "", fmt.Errorf("content does not match CID: %s", cid)
+	}
+
+	path := filepath.Join(utils.ReplicaPath, cid)
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return path, nil
+}
+
+// discardReplica removes the copy of cid at path unless an entry stored by a
+// concurrent writer refers to it.
+func (n *Network) discardReplica(cid, path string) {
+	if entry, err := n.fileStore.GetEntry(cid); err == nil && entry.Path == path {
+		return
+	}
+	os.Remove(path)
+}
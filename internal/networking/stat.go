@@ -0,0 +1,97 @@
+package networking
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/gokul656/obscure-fs/internal/storage"
+	"github.com/gokul656/obscure-fs/utils"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// StatFile returns the metadata of cid without transferring its content.
+// Local files are answered directly, otherwise the providers known from the
+// catalog and the DHT are asked over the stat command, healthiest first,
+// until ctx is done.
+func (n *Network) StatFile(ctx context.Context, cid, token string) (storage.FileStat, error) {
+	if entry, err := n.fileStore.GetEntry(cid); err == nil {
+		return entry.Stat(cid, n.host.ID().String()), nil
+	}
+
+	var stat storage.FileStat
+	err := n.tryPeers(ctx, n.statProviders(ctx, cid), func(id peer.ID) (int64, error) {
+		var err error
+		stat, err = n.statFromPeer(ctx, id, cid, token)
+		if err != nil {
+			log.Printf("failed to stat CID: %s on peer: %s, error: %v\n", cid, id, err)
+		}
+		return 0, err
+	})
+	if err != nil {
+		return storage.FileStat{}, fmt.Errorf("no providers found for CID: %s, error: %w", cid, err)
+	}
+	return stat, nil
+}
+
+func (n *Network) statProviders(ctx context.Context, cid string) []peer.ID {
+	var ids []peer.ID
+	seen := make(map[peer.ID]bool)
+
+	if entry, ok := n.catalog.Get(cid); ok {
+		for _, p := range entry.Providers {
+			if id, err := peer.Decode(p); err == nil && !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	if len(ids) == 0 {
+		providers, _ := n.FindFile(ctx, cid)
+		for _, p := range providers {
+			if !seen[p.ID] && p.ID != n.host.ID() {
+				seen[p.ID] = true
+				ids = append(ids, p.ID)
+			}
+		}
+	}
+	return ids
+}
+
+func (n *Network) statFromPeer(ctx context.Context, id peer.ID, cid, token string) (storage.FileStat, error) {
+	ctx, cancel := withTimeout(ctx, n.timeouts.Request)
+	defer cancel()
+
+	stream, err := n.host.NewStream(ctx, id, utils.ProtocolID)
+	if err != nil {
+		return storage.FileStat{}, err
+	}
+	defer stream.Close()
+	defer bindStream(ctx, stream)()
+
+	request := fmt.Sprintf("stat %s", cid)
+	if token != "" {
+		request = fmt.Sprintf("%s %s", request, token)
+	}
+	if _, err := stream.Write([]byte(request + "\n")); err != nil {
+		return storage.FileStat{}, err
+	}
+
+	data, err := io.ReadAll(stream)
+	if err != nil {
+		return storage.FileStat{}, streamErr(ctx, err)
+	}
+	if len(data) == 0 {
+		return storage.FileStat{}, errNotServed
+	}
+
+	var stat storage.FileStat
+	if err := json.Unmarshal(data, &stat); err != nil {
+		return storage.FileStat{}, err
+	}
+	stat.Provider = id.String()
+	return stat, nil
+}
@@ -0,0 +1,59 @@
+package networking
+
+import (
+	"context"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// Timeouts bound the operations of the network. Each operation also stops
+// as soon as the context it was called with is done, 0 leaves it bounded by
+// that context alone.
+type Timeouts struct {
+	// Lookup bounds a DHT query for a peer or the providers of a file.
+	Lookup time.Duration `json:"lookup"`
+	// Announce bounds advertising a file on the DHT.
+	Announce time.Duration `json:"announce"`
+	// Request bounds a request to a peer that moves no content, such as a
+	// stat, a ping or a file listing.
+	Request time.Duration `json:"request"`
+	// Transfer bounds retrieving a file from one provider and pushing or
+	// receiving a replica.
+	Transfer time.Duration `json:"transfer"`
+}
+
+var DefaultTimeouts = Timeouts{
+	Lookup:   30 * time.Second,
+	Announce: time.Minute,
+	Request:  15 * time.Second,
+	Transfer: 10 * time.Minute,
+}
+
+func (n *Network) Timeouts() Timeouts {
+	return n.timeouts
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// bindStream resets stream once ctx is done, a stream only heeds the
+// context it was opened with while opening. The returned func stops it.
+// The stream gets no deadline of its own, one racing ctx would end reads
+// with its own error and close the stream rather than reset it.
+func bindStream(ctx context.Context, stream network.Stream) func() bool {
+	return context.AfterFunc(ctx, func() { stream.Reset() })
+}
+
+// streamErr is the error of a read or write on a stream bound to ctx, a
+// stream reset by bindStream reports the reset rather than why it happened.
+func streamErr(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
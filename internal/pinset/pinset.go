@@ -0,0 +1,176 @@
+package pinset
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gokul656/obscure-fs/utils"
+)
+
+// maxClockSkew bounds how far ahead of the local time a merged clock may
+// be. A pin stamped further ahead would win over every later update.
+const maxClockSkew = time.Minute
+
+// Pin is the latest intent for a CID. Unpinning keeps the entry around as a
+// tombstone, so an older pin arriving late cannot bring it back.
+type Pin struct {
+	CID      string    `json:"cid"`
+	Name     string    `json:"name,omitempty"`
+	Replicas int       `json:"replicas"`
+	Expires  time.Time `json:"expires,omitempty"`
+	Pinned   bool      `json:"pinned"`
+	// Clock and Author order concurrent updates, the highest wins.
+	Clock  int64  `json:"clock"`
+	Author string `json:"author"`
+	// Signature is the author's signature of Payload, it lets any node pass
+	// the pin on.
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// Payload is what the author of p signs, p without its signature.
+func (p Pin) Payload() []byte {
+	p.Signature = nil
+	data, _ := json.Marshal(p)
+	return data
+}
+
+// Active reports whether the pin holds at now.
+func (p Pin) Active(now time.Time) bool {
+	return p.Pinned && (p.Expires.IsZero() || now.Before(p.Expires))
+}
+
+func (p Pin) newer(q Pin) bool {
+	if p.Clock != q.Clock {
+		return p.Clock > q.Clock
+	}
+	return p.Author > q.Author
+}
+
+// Set is a last-writer-wins map of pins, a state-based CRDT: merging the
+// states of any two nodes in any order converges on the same set.
+type Set struct {
+	mu    sync.RWMutex
+	path  string
+	pins  map[string]Pin
+	clock int64
+	sign  func([]byte) ([]byte, error)
+}
+
+// NewSet loads the pin set persisted at path.
+func NewSet(path string) (*Set, error) {
+	s := &Set{path: path, pins: make(map[string]Pin)}
+	if err := utils.ReadJSONFile(path, &s.pins); err != nil {
+		return nil, fmt.Errorf("failed to load pin set: %w", err)
+	}
+	for _, p := range s.pins {
+		s.clock = max(s.clock, p.Clock)
+	}
+	return s, nil
+}
+
+// SignWith makes Update sign the pins it stamps with sign.
+func (s *Set) SignWith(sign func([]byte) ([]byte, error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sign = sign
+}
+
+// Update stamps p with a clock ahead of every update seen so far, signs it
+// and applies it.
+func (s *Set) Update(p Pin) (Pin, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// merged clocks are never far ahead of now, the increment only breaks
+	// ties with them
+	p.Clock = time.Now().UnixNano()
+	if p.Clock <= s.clock {
+		p.Clock = s.clock + 1
+	}
+	p.Signature = nil
+	if s.sign != nil {
+		signature, err := s.sign(p.Payload())
+		if err != nil {
+			return p, fmt.Errorf("failed to sign pin: %w", err)
+		}
+		p.Signature = signature
+	}
+	s.clock = p.Clock
+	s.pins[p.CID] = p
+	return p, s.save()
+}
+
+// Merge applies pins that are newer than what the set holds and returns
+// them. Pins with a clock too far ahead of now are ignored.
+func (s *Set) Merge(pins []Pin) ([]Pin, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var changed []Pin
+	horizon := time.Now().Add(maxClockSkew).UnixNano()
+	for _, p := range pins {
+		if p.Clock > horizon {
+			continue
+		}
+		if current, ok := s.pins[p.CID]; ok && !p.newer(current) {
+			continue
+		}
+		s.pins[p.CID] = p
+		s.clock = max(s.clock, p.Clock)
+		changed = append(changed, p)
+	}
+
+	if len(changed) == 0 {
+		return nil, nil
+	}
+	return changed, s.save()
+}
+
+func (s *Set) Get(cid string) (Pin, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.pins[cid]
+	return p, ok
+}
+
+// IsPinned reports whether cid has an active pin.
+func (s *Set) IsPinned(cid string) bool {
+	p, ok := s.Get(cid)
+	return ok && p.Active(time.Now())
+}
+
+// All returns every pin including tombstones, the state exchanged between
+// nodes.
+func (s *Set) All() []Pin {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pins := make([]Pin, 0, len(s.pins))
+	for _, p := range s.pins {
+		pins = append(pins, p)
+	}
+	sort.Slice(pins, func(i, j int) bool { return pins[i].CID < pins[j].CID })
+	return pins
+}
+
+// Active returns the pins holding at now.
+func (s *Set) Active(now time.Time) []Pin {
+	var active []Pin
+	for _, p := range s.All() {
+		if p.Active(now) {
+			active = append(active, p)
+		}
+	}
+	return active
+}
+
+// save must be called with the lock held.
+func (s *Set) save() error {
+	if s.path == "" {
+		return nil
+	}
+	return utils.WriteJSONFile(s.path, s.pins)
+}
@@ -0,0 +1,134 @@
+package placement
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+)
+
+// DefaultWeight stands in for the capacity of nodes that do not advertise
+// one.
+const DefaultWeight = 1 << 30
+
+// Candidate is a node that may be asked to hold data.
+type Candidate struct {
+	ID       string `json:"id"`
+	Zone     string `json:"zone,omitempty"`
+	Capacity int64  `json:"capacity"`
+	Free     int64  `json:"free"`
+	// Score is how strongly the strategy prefers the node, higher first.
+	Score float64 `json:"score"`
+}
+
+// weight is the advertised capacity. Free space changes with every upload
+// and would move keys between nodes, it only decides admission.
+func (c Candidate) weight() float64 {
+	if c.Capacity <= 0 {
+		return DefaultWeight
+	}
+	return float64(c.Capacity)
+}
+
+// Admits reports whether the candidate has room for size more bytes. Nodes
+// that do not advertise their capacity are always admitted.
+func (c Candidate) Admits(size int64) bool {
+	return c.Capacity <= 0 || c.Free >= size
+}
+
+// Strategy decides where the copies of a key go.
+type Strategy interface {
+	// Rank returns every candidate, the preferred first. zones lists the
+	// zones already holding a copy.
+	Rank(key string, candidates []Candidate, zones []string) []Candidate
+	String() string
+}
+
+func Parse(s string) (Strategy, error) {
+	switch s {
+	case "", "rendezvous":
+		return Rendezvous{}, nil
+	case "random":
+		return Random{}, nil
+	default:
+		return nil, fmt.Errorf("unknown placement strategy: %s", s)
+	}
+}
+
+// Rendezvous ranks nodes by highest random weight hashing of the key and
+// node ID, weighted by advertised capacity. Every node computes the same ranking
+// without coordination, and only the keys of a node that joins or leaves
+// move. Copies are spread over as many zones as possible.
+type Rendezvous struct{}
+
+func (Rendezvous) String() string {
+	return "rendezvous"
+}
+
+func (Rendezvous) Rank(key string, candidates []Candidate, zones []string) []Candidate {
+	ranked := slices.Clone(candidates)
+	for i := range ranked {
+		ranked[i].Score = score(key, ranked[i])
+	}
+	slices.SortStableFunc(ranked, func(a, b Candidate) int {
+		switch {
+		case a.Score > b.Score:
+			return -1
+		case a.Score < b.Score:
+			return 1
+		}
+		return 0
+	})
+	return spreadZones(ranked, zones)
+}
+
+// score is the weighted rendezvous score -w/ln(h), with h the hash of key
+// and node mapped to (0, 1).
+func score(key string, c Candidate) float64 {
+	sum := sha256.Sum256([]byte(key + "/" + c.ID))
+	h := (float64(binary.BigEndian.Uint64(sum[:8])) + 0.5) / math.Exp2(64)
+	return -c.weight() / math.Log(h)
+}
+
+// spreadZones keeps the order of ranked, except that nodes in a zone not
+// holding a copy yet go first. Once every zone holds one it starts over.
+// Nodes without a zone never conflict.
+func spreadZones(ranked []Candidate, zones []string) []Candidate {
+	used := make(map[string]bool)
+	for _, z := range zones {
+		if z != "" {
+			used[z] = true
+		}
+	}
+
+	result := make([]Candidate, 0, len(ranked))
+	for len(ranked) > 0 {
+		i := slices.IndexFunc(ranked, func(c Candidate) bool { return c.Zone == "" || !used[c.Zone] })
+		if i < 0 {
+			clear(used)
+			continue
+		}
+
+		result = append(result, ranked[i])
+		used[ranked[i].Zone] = true
+		ranked = slices.Delete(ranked, i, i+1)
+	}
+	return result
+}
+
+// Random places copies on arbitrary nodes.
+type Random struct{}
+
+func (Random) String() string {
+	return "random"
+}
+
+func (Random) Rank(key string, candidates []Candidate, zones []string) []Candidate {
+	ranked := slices.Clone(candidates)
+	rand.Shuffle(len(ranked), func(i, j int) {
+		ranked[i], ranked[j] = ranked[j], ranked[i]
+	})
+	return ranked
+}
@@ -0,0 +1,166 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Document is a searchable file, keyed by CID.
+type Document struct {
+	CID       string   `json:"cid"`
+	Name      string   `json:"name"`
+	Size      int64    `json:"size"`
+	MIME      string   `json:"mime"`
+	Tags      []string `json:"tags"`
+	Providers []string `json:"providers,omitempty"`
+}
+
+type Query struct {
+	// Text terms must all match a name or tag token, as a prefix.
+	Text    string
+	Tag     string
+	MIME    string
+	MinSize int64
+	MaxSize int64
+}
+
+// Index is an in-memory inverted index over document names and tags.
+type Index struct {
+	mu       sync.RWMutex
+	docs     map[string]Document
+	postings map[string]map[string]struct{}
+}
+
+func NewIndex() *Index {
+	return &Index{
+		docs:     make(map[string]Document),
+		postings: make(map[string]map[string]struct{}),
+	}
+}
+
+func (idx *Index) Put(doc Document) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(doc.CID)
+	idx.docs[doc.CID] = doc
+	for _, token := range documentTokens(doc) {
+		docs, ok := idx.postings[token]
+		if !ok {
+			docs = make(map[string]struct{})
+			idx.postings[token] = docs
+		}
+		docs[doc.CID] = struct{}{}
+	}
+}
+
+func (idx *Index) Delete(cid string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(cid)
+}
+
+func (idx *Index) Get(cid string) (Document, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	doc, ok := idx.docs[cid]
+	return doc, ok
+}
+
+func (idx *Index) remove(cid string) {
+	doc, ok := idx.docs[cid]
+	if !ok {
+		return
+	}
+
+	for _, token := range documentTokens(doc) {
+		delete(idx.postings[token], cid)
+		if len(idx.postings[token]) == 0 {
+			delete(idx.postings, token)
+		}
+	}
+	delete(idx.docs, cid)
+}
+
+// Search returns the documents matching q ordered by name.
+func (idx *Index) Search(q Query) []Document {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var candidates map[string]struct{}
+	for _, term := range Tokenize(q.Text) {
+		matches := make(map[string]struct{})
+		for token, docs := range idx.postings {
+			if !strings.HasPrefix(token, term) {
+				continue
+			}
+			for cid := range docs {
+				if candidates == nil {
+					matches[cid] = struct{}{}
+				} else if _, ok := candidates[cid]; ok {
+					matches[cid] = struct{}{}
+				}
+			}
+		}
+		candidates = matches
+	}
+
+	results := make([]Document, 0)
+	for cid, doc := range idx.docs {
+		if candidates != nil {
+			if _, ok := candidates[cid]; !ok {
+				continue
+			}
+		}
+		if q.matchesFilters(doc) {
+			results = append(results, doc)
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Name != results[j].Name {
+			return results[i].Name < results[j].Name
+		}
+		return results[i].CID < results[j].CID
+	})
+	return results
+}
+
+func (q Query) matchesFilters(doc Document) bool {
+	if q.MIME != "" && !strings.HasPrefix(doc.MIME, q.MIME) {
+		return false
+	}
+	if q.MinSize > 0 && doc.Size < q.MinSize {
+		return false
+	}
+	if q.MaxSize > 0 && doc.Size > q.MaxSize {
+		return false
+	}
+	if q.Tag != "" {
+		for _, tag := range doc.Tags {
+			if strings.EqualFold(tag, q.Tag) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Tokenize lowercases s and splits it on anything that is not a letter or
+// digit, so "Q3-report.pdf" yields q3, report and pdf.
+func Tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func documentTokens(doc Document) []string {
+	tokens := Tokenize(doc.Name)
+	for _, tag := range doc.Tags {
+		tokens = append(tokens, Tokenize(tag)...)
+	}
+	return tokens
+}
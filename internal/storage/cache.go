@@ -0,0 +1,259 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// EvictionPolicy picks which cached files go first when the cache is full.
+type EvictionPolicy string
+
+const (
+	// LRU evicts the files read least recently.
+	LRU EvictionPolicy = "lru"
+	// LFU evicts the files read least often.
+	LFU EvictionPolicy = "lfu"
+)
+
+func ParseEvictionPolicy(s string) (EvictionPolicy, error) {
+	switch EvictionPolicy(s) {
+	case "", LRU:
+		return LRU, nil
+	case LFU:
+		return LFU, nil
+	default:
+		return "", fmt.Errorf("unknown eviction policy: %s", s)
+	}
+}
+
+// partialExt marks files still being written into the cache.
+const partialExt = ".part"
+
+type cacheItem struct {
+	size     int64
+	lastUsed time.Time
+	hits     int
+}
+
+// CacheUsage reports how full the retrieval cache is.
+type CacheUsage struct {
+	Used   int64          `json:"used"`
+	Limit  int64          `json:"limit"`
+	Files  int            `json:"files"`
+	Policy EvictionPolicy `json:"policy"`
+}
+
+// Cache keeps content retrieved from the network in dir, evicting files by
+// policy once they take more than limit bytes. A limit of 0 means unlimited.
+type Cache struct {
+	dir    string
+	limit  int64
+	policy EvictionPolicy
+	items  map[string]*cacheItem
+	used   int64
+	mu     sync.Mutex
+}
+
+// NewCache picks up the files already in dir, so the limit holds across
+// restarts.
+func NewCache(dir string, limit int64, policy EvictionPolicy) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if policy == "" {
+		policy = LRU
+	}
+
+	c := &Cache{
+		dir:    dir,
+		limit:  limit,
+		policy: policy,
+		items:  make(map[string]*cacheItem),
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if filepath.Ext(e.Name()) == partialExt {
+			// left behind by a retrieval that never finished
+			os.Remove(filepath.Join(dir, e.Name()))
+			continue
+		}
+		c.items[e.Name()] = &cacheItem{size: info.Size(), lastUsed: info.ModTime()}
+		c.used += info.Size()
+	}
+	c.evictLocked("")
+	return c, nil
+}
+
+// Path is where cid is kept, whether it is cached yet or not.
+func (c *Cache) Path(cid string) string {
+	return filepath.Join(c.dir, cid)
+}
+
+// Get returns where cid is cached and counts the read, files that vanished
+// from disk are dropped.
+func (c *Cache) Get(cid string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, exists := c.items[cid]
+	if !exists {
+		return "", false
+	}
+	if _, err := os.Stat(c.Path(cid)); err != nil {
+		c.removeLocked(cid)
+		return "", false
+	}
+
+	item.lastUsed = time.Now()
+	item.hits++
+	return c.Path(cid), true
+}
+
+// Open opens the cached copy of cid and counts the read. The file is opened
+// under the cache lock, so that it cannot be evicted before, and stays
+// readable through the handle once it is.
+func (c *Cache) Open(cid string) (*os.File, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, exists := c.items[cid]
+	if !exists {
+		return nil, false
+	}
+	f, err := os.Open(c.Path(cid))
+	if err != nil {
+		c.removeLocked(cid)
+		return nil, false
+	}
+
+	item.lastUsed = time.Now()
+	item.hits++
+	return f, true
+}
+
+// PartialPath is where cid is written before it is added.
+func (c *Cache) PartialPath(cid string) string {
+	return c.Path(cid) + partialExt
+}
+
+// Add accounts for the file written at Path(cid), or moves it there from
+// PartialPath(cid), and evicts others to make room for it.
+func (c *Cache) Add(cid string) error {
+	if err := os.Rename(c.PartialPath(cid), c.Path(cid)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	info, err := os.Stat(c.Path(cid))
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, exists := c.items[cid]
+	if !exists {
+		item = &cacheItem{}
+		c.items[cid] = item
+	}
+	c.used += info.Size() - item.size
+	item.size = info.Size()
+	item.lastUsed = time.Now()
+	item.hits++
+
+	c.evictLocked(cid)
+	return nil
+}
+
+// Remove drops cid from the cache.
+func (c *Cache) Remove(cid string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeLocked(cid)
+}
+
+// Prune removes the files not read within grace, along with files that
+// vanished from disk.
+func (c *Cache) Prune(grace time.Duration) (files int, bytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cutoff := time.Now().Add(-grace)
+	for cid, item := range c.items {
+		if item.lastUsed.After(cutoff) {
+			continue
+		}
+		size := item.size
+		if c.removeLocked(cid) {
+			files++
+			bytes += size
+		}
+	}
+	return files, bytes
+}
+
+func (c *Cache) Usage() CacheUsage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheUsage{Used: c.used, Limit: c.limit, Files: len(c.items), Policy: c.policy}
+}
+
+// evictLocked removes files by policy until the cache fits its limit. keep
+// is never evicted, a single file larger than the limit stays until the
+// next one is added.
+func (c *Cache) evictLocked(keep string) {
+	for c.limit > 0 && c.used > c.limit {
+		victim := ""
+		for cid, item := range c.items {
+			if cid == keep {
+				continue
+			}
+			if victim == "" || c.before(item, c.items[victim]) {
+				victim = cid
+			}
+		}
+		if victim == "" {
+			return
+		}
+
+		log.Printf("cache: evicting %s (%d bytes)\n", victim, c.items[victim].size)
+		c.removeLocked(victim)
+	}
+}
+
+// before reports whether a should be evicted ahead of b.
+func (c *Cache) before(a, b *cacheItem) bool {
+	if c.policy == LFU && a.hits != b.hits {
+		return a.hits < b.hits
+	}
+	return a.lastUsed.Before(b.lastUsed)
+}
+
+// removeLocked reports whether a file was actually removed from disk.
+func (c *Cache) removeLocked(cid string) bool {
+	item, exists := c.items[cid]
+	if !exists {
+		return false
+	}
+	delete(c.items, cid)
+	c.used -= item.size
+
+	if err := os.Remove(c.Path(cid)); err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("cache: failed to remove %s: %v\n", cid, err)
+		}
+		return false
+	}
+	return true
+}
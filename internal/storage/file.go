@@ -13,6 +13,10 @@ type Metadata struct {
 	Pairty   int
 	Checksum string
 	Parts    []string
+
+	// Size is the true length of the content; shards only reveal the padded one.
+	Size    int64
+	Padding string
 }
 
 func (m Metadata) GetShardSum() int {
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+// GCResult reports what a delete or garbage collection reclaimed.
+type GCResult struct {
+	// Removed lists the unpinned CIDs dropped from the store.
+	Removed []string `json:"removed"`
+	// Entries holds the dropped entries, keyed by CID.
+	Entries        map[string]FileEntry `json:"-"`
+	FilesReclaimed int                  `json:"files_reclaimed"`
+	BytesReclaimed int64                `json:"bytes_reclaimed"`
+}
+
+// Pin keeps cid through garbage collection.
+func (fs *FileStore) Pin(cid string) error {
+	return fs.setPinned(cid, true)
+}
+
+// Unpin makes cid eligible for the next garbage collection.
+func (fs *FileStore) Unpin(cid string) error {
+	return fs.setPinned(cid, false)
+}
+
+func (fs *FileStore) setPinned(cid string, pinned bool) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	entry, exists := fs.files[cid]
+	if !exists {
+		return fmt.Errorf("file not found for CID: %s", cid)
+	}
+	entry.Pinned = pinned
+	fs.files[cid] = entry
+	return nil
+}
+
+// Delete drops cid right away, pinned or not, and removes the files backing
+// it unless another entry still references them.
+func (fs *FileStore) Delete(cid string) (FileEntry, GCResult, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	entry, exists := fs.files[cid]
+	if !exists {
+		return FileEntry{}, GCResult{}, fmt.Errorf("file not found for CID: %s", cid)
+	}
+
+	result := GCResult{Removed: []string{cid}, Entries: map[string]FileEntry{cid: entry}}
+	fs.dropLocked(cid)
+	fs.reclaimLocked(entry.blobs(), &result)
+	return entry, result, nil
+}
+
+// CollectGarbage drops every unpinned entry that retain, when not nil, does
+// not keep, and reclaims the files no longer referenced by any entry.
+func (fs *FileStore) CollectGarbage(retain func(cid string) bool) GCResult {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	result := GCResult{Removed: []string{}, Entries: make(map[string]FileEntry)}
+	var candidates []string
+	for cid, entry := range fs.files {
+		if entry.Pinned || (retain != nil && retain(cid)) {
+			continue
+		}
+		result.Removed = append(result.Removed, cid)
+		result.Entries[cid] = entry
+		candidates = append(candidates, entry.blobs()...)
+		fs.dropLocked(cid)
+	}
+	fs.reclaimLocked(candidates, &result)
+	return result
+}
+
+func (fs *FileStore) dropLocked(cid string) {
+	delete(fs.files, cid)
+	fs.index.Delete(cid)
+}
+
+// reclaimLocked removes the given files unless a remaining entry still
+// references them, identical content shares its files between entries.
+func (fs *FileStore) reclaimLocked(blobs []string, result *GCResult) {
+	refs := make(map[string]int)
+	for _, entry := range fs.files {
+		for _, blob := range entry.blobs() {
+			refs[blob]++
+		}
+	}
+
+	for _, blob := range blobs {
+		if refs[blob] > 0 {
+			continue
+		}
+		// a blob listed twice is only removed once
+		refs[blob]++
+
+		info, err := os.Stat(blob)
+		if err != nil {
+			continue
+		}
+		if err := os.Remove(blob); err != nil {
+			log.Printf("failed to remove %s: %v\n", blob, err)
+			continue
+		}
+		result.FilesReclaimed++
+		result.BytesReclaimed += info.Size()
+	}
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Quota limits the bytes held by the store, 0 means unlimited.
+type Quota struct {
+	Node int64 `json:"node"`
+	// PerUploader applies to uploaders without a limit of their own.
+	PerUploader int64 `json:"per_uploader"`
+}
+
+// QuotaError tells which limit an upload would exceed.
+type QuotaError struct {
+	Scope     string `json:"scope"`
+	Limit     int64  `json:"limit"`
+	Used      int64  `json:"used"`
+	Requested int64  `json:"requested"`
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s quota exceeded: %d of %d bytes used, %d more requested", e.Scope, e.Used, e.Limit, e.Requested)
+}
+
+func (e *QuotaError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+func (fs *FileStore) SetQuota(q Quota) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.quota = q
+}
+
+func (fs *FileStore) Quota() Quota {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	return fs.quota
+}
+
+// Usage returns the bytes held by the store, and by uploader when it is not
+// empty.
+func (fs *FileStore) Usage(uploader string) (node, byUploader int64) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	return fs.usageLocked(uploader)
+}
+
+// CheckQuota fails when uploader adding size bytes would exceed the node
+// quota, or limit for the uploader. A limit of 0 falls back to the default
+// per uploader quota.
+func (fs *FileStore) CheckQuota(uploader string, limit, size int64) error {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	return fs.checkQuotaLocked(uploader, limit, size)
+}
+
+func (fs *FileStore) checkQuotaLocked(uploader string, limit, size int64) error {
+	if limit == 0 {
+		limit = fs.quota.PerUploader
+	}
+
+	node, byUploader := fs.usageLocked(uploader)
+	if fs.quota.Node > 0 && node+size > fs.quota.Node {
+		return &QuotaError{Scope: "node", Limit: fs.quota.Node, Used: node, Requested: size}
+	}
+	if limit > 0 && byUploader+size > limit {
+		return &QuotaError{Scope: "uploader", Limit: limit, Used: byUploader, Requested: size}
+	}
+	return nil
+}
+
+// usageLocked sums the disk size of entries.
+func (fs *FileStore) usageLocked(uploader string) (node, byUploader int64) {
+	for _, entry := range fs.files {
+		node += entry.DiskSize()
+		if uploader != "" && entry.Uploader == uploader {
+			byUploader += entry.DiskSize()
+		}
+	}
+	return node, byUploader
+}
@@ -1,52 +1,281 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"mime"
+	"net/http"
 	"os"
+	"path/filepath"
+	"slices"
 	"sync"
+	"time"
+
+	"github.com/gokul656/obscure-fs/internal/search"
 )
 
+type Visibility string
+
+const (
+	// Public files are advertised through list_files.
+	Public Visibility = "public"
+	// Unlisted files are served to anyone who knows the CID.
+	Unlisted Visibility = "unlisted"
+	// Private files are served to authorized peers only.
+	Private Visibility = "private"
+)
+
+func ParseVisibility(s string) (Visibility, error) {
+	switch Visibility(s) {
+	case "":
+		return Public, nil
+	case Public, Unlisted, Private:
+		return Visibility(s), nil
+	default:
+		return "", fmt.Errorf("invalid visibility: %s", s)
+	}
+}
+
+// CodecInfo records how the stored bytes are laid out on disk.
+type CodecInfo struct {
+	Name    string `json:"name"`
+	Shards  int    `json:"shards,omitempty"`
+	Parity  int    `json:"parity,omitempty"`
+	Padding string `json:"padding,omitempty"`
+	// PaddedSize is the size of the content once padded, 0 when unpadded.
+	PaddedSize int64 `json:"padded_size,omitempty"`
+}
+
+// RawCodec is used for files stored as a single plain file.
+var RawCodec = CodecInfo{Name: "raw"}
+
+type FileEntry struct {
+	// Path is never serialized, local layout must not leave the node.
+	Path       string     `json:"-"`
+	Visibility Visibility `json:"visibility"`
+	Name       string     `json:"name"`
+	Size       int64      `json:"size"`
+	MIME       string     `json:"mime"`
+	Tags       []string   `json:"tags"`
+	UploadedAt time.Time  `json:"uploaded_at"`
+	Uploader   string     `json:"uploader"`
+	Codec      CodecInfo  `json:"codec"`
+	// Pinned entries are never garbage collected.
+	Pinned bool `json:"pinned"`
+	// Replicas is the number of nodes meant to hold the file, this one
+	// included. 0 and 1 both mean no replication.
+	Replicas int `json:"replicas,omitempty"`
+	// Holders are the other peers known to store a copy.
+	Holders []string `json:"holders,omitempty"`
+	// Blobs are on-disk files backing the entry besides Path, such as shards.
+	Blobs []string `json:"-"`
+}
+
+// blobs returns every on-disk file backing the entry.
+func (e FileEntry) blobs() []string {
+	blobs := make([]string, 0, len(e.Blobs)+1)
+	if e.Path != "" {
+		blobs = append(blobs, e.Path)
+	}
+	return append(blobs, e.Blobs...)
+}
+
+// FileStat is the public metadata of a stored object, served without its
+// content. Who uploaded it and which peers hold it stay on the node.
+type FileStat struct {
+	CID        string     `json:"cid"`
+	Visibility Visibility `json:"visibility"`
+	Name       string     `json:"name"`
+	// Size is rounded up by Padding when the file is padded.
+	Size       int64     `json:"size"`
+	Padding    string    `json:"padding,omitempty"`
+	MIME       string    `json:"mime"`
+	Tags       []string  `json:"tags"`
+	UploadedAt time.Time `json:"uploaded_at"`
+	// Provider is the peer the stat was answered by.
+	Provider string `json:"provider"`
+}
+
+// Stat describes the entry as provider serves it to others.
+func (e FileEntry) Stat(cid, provider string) FileStat {
+	stat := FileStat{
+		CID:        cid,
+		Visibility: e.Visibility,
+		Name:       e.Name,
+		Size:       e.PublicSize(),
+		MIME:       e.MIME,
+		Tags:       e.Tags,
+		UploadedAt: e.UploadedAt,
+		Provider:   provider,
+	}
+	if e.Codec.PaddedSize > 0 {
+		stat.Padding = e.Codec.Padding
+	}
+	return stat
+}
+
+// DiskSize is the space the entry takes on disk, its erasure coded shards
+// included. Shards split the padded content evenly and are rounded up.
+func (e FileEntry) DiskSize() int64 {
+	size := e.Size
+	if shards := int64(e.Codec.Shards); shards > 0 {
+		perShard := (max(e.Codec.PaddedSize, e.Size) + shards - 1) / shards
+		size += perShard * (shards + int64(e.Codec.Parity))
+	}
+	return size
+}
+
+// PublicSize is the size other peers may learn, padded files only reveal
+// their padded size.
+func (e FileEntry) PublicSize() int64 {
+	if e.Codec.PaddedSize > 0 {
+		return e.Codec.PaddedSize
+	}
+	return e.Size
+}
+
+// Document describes the entry for search and for other peers.
+func (e FileEntry) Document(cid string) search.Document {
+	return search.Document{
+		CID:  cid,
+		Name: e.Name,
+		Size: e.PublicSize(),
+		MIME: e.MIME,
+		Tags: e.Tags,
+	}
+}
+
+var ErrFileExists = errors.New("file already stored")
+
 type FileStore struct {
-	files map[string]string
+	files map[string]FileEntry
+	index *search.Index
+	quota Quota
 	mu    sync.RWMutex
 }
 
 func NewFileStore() *FileStore {
 	return &FileStore{
-		files: make(map[string]string),
+		files: make(map[string]FileEntry),
+		index: search.NewIndex(),
 		mu:    sync.RWMutex{},
 	}
 }
 
-func (fs *FileStore) StoreFile(cid string, path string) error {
+// StoreFile records entry under cid within the default per uploader quota.
+func (fs *FileStore) StoreFile(cid string, entry FileEntry) error {
+	return fs.StoreFileWithin(cid, entry, 0)
+}
+
+// StoreFileWithin records entry under cid, it fails when the entry would
+// take the store over its node quota or entry.Uploader over limit, which
+// falls back to the per uploader quota when 0. A CID already stored keeps
+// its entry and fails with ErrFileExists.
+func (fs *FileStore) StoreFileWithin(cid string, entry FileEntry, limit int64) error {
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
-	fs.files[cid] = path
+
+	if _, exists := fs.files[cid]; exists {
+		return ErrFileExists
+	}
+	if err := fs.checkQuotaLocked(entry.Uploader, limit, entry.DiskSize()); err != nil {
+		return err
+	}
+	fs.files[cid] = entry
+	fs.index.Put(entry.Document(cid))
 	return nil
 }
 
+// Search looks up local files of any visibility.
+func (fs *FileStore) Search(q search.Query) []search.Document {
+	return fs.index.Search(q)
+}
+
 func (fs *FileStore) GetFile(cid string) (string, error) {
+	entry, err := fs.GetEntry(cid)
+	if err != nil {
+		return "", err
+	}
+	return entry.Path, nil
+}
+
+func (fs *FileStore) GetEntry(cid string) (FileEntry, error) {
 	fs.mu.RLock()
 	defer fs.mu.RUnlock()
 
-	path, exists := fs.files[cid]
+	entry, exists := fs.files[cid]
+	if !exists {
+		return FileEntry{}, fmt.Errorf("file not found for CID: %s", cid)
+	}
+	return entry, nil
+}
+
+func (fs *FileStore) SetVisibility(cid string, visibility Visibility) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	entry, exists := fs.files[cid]
 	if !exists {
-		return "", fmt.Errorf("file not found for CID: %s", cid)
+		return fmt.Errorf("file not found for CID: %s", cid)
+	}
+	entry.Visibility = visibility
+	fs.files[cid] = entry
+	return nil
+}
+
+// AddHolders records peers storing a copy of cid.
+func (fs *FileStore) AddHolders(cid string, holders ...string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	entry, exists := fs.files[cid]
+	if !exists {
+		return
+	}
+	for _, h := range holders {
+		if !slices.Contains(entry.Holders, h) {
+			entry.Holders = append(slices.Clone(entry.Holders), h)
+		}
 	}
-	return path, nil
+	fs.files[cid] = entry
 }
 
-func (fs *FileStore) ListFiles() map[string]string {
+// SetHolders replaces the peers known to store a copy of cid.
+func (fs *FileStore) SetHolders(cid string, holders []string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if entry, exists := fs.files[cid]; exists {
+		entry.Holders = holders
+		fs.files[cid] = entry
+	}
+}
+
+func (fs *FileStore) ListFiles() map[string]FileEntry {
 	fs.mu.RLock()
 	defer fs.mu.RUnlock()
 	// Return a copy of the map to prevent modification by callers.
-	copy := make(map[string]string, len(fs.files))
+	copy := make(map[string]FileEntry, len(fs.files))
 	for k, v := range fs.files {
 		copy[k] = v
 	}
 	return copy
 }
 
+// ListPublicFiles returns the files that may be advertised to other peers.
+func (fs *FileStore) ListPublicFiles() []search.Document {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	docs := make([]search.Document, 0, len(fs.files))
+	for cid, entry := range fs.files {
+		if entry.Visibility == Public {
+			docs = append(docs, entry.Document(cid))
+		}
+	}
+	return docs
+}
+
 func GetFileSize(path string) (int64, error) {
 	fileInfo, err := os.Stat(path)
 	if err != nil {
@@ -54,3 +283,24 @@ func GetFileSize(path string) (int64, error) {
 	}
 	return fileInfo.Size(), nil
 }
+
+// DetectMIME guesses the content type from the extension, falling back to
+// sniffing the first bytes of the file.
+func DetectMIME(path string) (string, error) {
+	if byExt := mime.TypeByExtension(filepath.Ext(path)); byExt != "" {
+		return byExt, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	return http.DetectContentType(head[:n]), nil
+}
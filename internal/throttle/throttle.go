@@ -0,0 +1,320 @@
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// chunkSize is the most bytes a transfer moves per wait, it is also how
+// many bytes a bucket holds when full.
+const chunkSize = 32 << 10
+
+// backgroundPoll is how often background transfers look again for tokens
+// that interactive ones are not waiting for.
+const backgroundPoll = 20 * time.Millisecond
+
+// Class is the priority of a transfer.
+type Class int
+
+const (
+	// Interactive transfers serve someone waiting on them.
+	Interactive Class = iota
+	// Background transfers, such as repairs, only take bandwidth that no
+	// interactive transfer waits for, and only start inside the background
+	// windows.
+	Background
+)
+
+func (c Class) String() string {
+	if c == Background {
+		return "background"
+	}
+	return "interactive"
+}
+
+// Limits are in bytes per second, 0 means unlimited.
+type Limits struct {
+	Upload       int64 `json:"upload"`
+	Download     int64 `json:"download"`
+	PeerUpload   int64 `json:"peer_upload"`
+	PeerDownload int64 `json:"peer_download"`
+}
+
+// Window is a daily time range, in local time, that may wrap past midnight.
+type Window struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// ParseWindows parses comma separated ranges such as "22:00-06:00".
+func ParseWindows(s string) ([]Window, error) {
+	var windows []Window
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		start, end, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid window: %q", part)
+		}
+		var w Window
+		var err error
+		if w.Start, err = parseClock(start); err != nil {
+			return nil, err
+		}
+		if w.End, err = parseClock(end); err != nil {
+			return nil, err
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day: %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func (w Window) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", int(w.Start.Hours()), int(w.Start.Minutes())%60, int(w.End.Hours()), int(w.End.Minutes())%60)
+}
+
+// Contains reports whether t falls in the window.
+func (w Window) Contains(t time.Time) bool {
+	y, m, d := t.Date()
+	since := t.Sub(time.Date(y, m, d, 0, 0, 0, 0, t.Location()))
+	if w.Start <= w.End {
+		return since >= w.Start && since < w.End
+	}
+	return since >= w.Start || since < w.End
+}
+
+// bucket is a token bucket in bytes. Background waiters step aside while
+// interactive ones wait.
+type bucket struct {
+	mu      sync.Mutex
+	rate    float64
+	tokens  float64
+	last    time.Time
+	waiting int
+}
+
+func newBucket(rate int64) *bucket {
+	return &bucket{rate: float64(rate), tokens: chunkSize, last: time.Now()}
+}
+
+func (b *bucket) wait(ctx context.Context, n int, class Class) error {
+	for registered := false; ; {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*b.rate, chunkSize)
+		b.last = now
+
+		yield := class == Background && b.waiting > 0
+		if !yield && b.tokens >= float64(n) {
+			b.tokens -= float64(n)
+			if registered {
+				b.waiting--
+			}
+			b.mu.Unlock()
+			return nil
+		}
+
+		delay := backgroundPoll
+		if class == Interactive {
+			if !registered {
+				b.waiting++
+				registered = true
+			}
+			delay = time.Duration((float64(n) - b.tokens) / b.rate * float64(time.Second))
+		}
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			if registered {
+				b.mu.Lock()
+				b.waiting--
+				b.mu.Unlock()
+			}
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Throttler paces transfers to the global and per-peer limits. A nil
+// Throttler does not limit anything.
+type Throttler struct {
+	limits   Limits
+	windows  []Window
+	upload   *bucket
+	download *bucket
+
+	mu    sync.Mutex
+	peers map[string]*peerBuckets
+}
+
+type peerBuckets struct {
+	upload   *bucket
+	download *bucket
+}
+
+// New returns a Throttler enforcing limits. Background transfers only start
+// inside windows, or at any time when there are none.
+func New(limits Limits, windows []Window) *Throttler {
+	t := &Throttler{limits: limits, windows: windows, peers: make(map[string]*peerBuckets)}
+	if limits.Upload > 0 {
+		t.upload = newBucket(limits.Upload)
+	}
+	if limits.Download > 0 {
+		t.download = newBucket(limits.Download)
+	}
+	return t
+}
+
+func (t *Throttler) Limits() Limits {
+	if t == nil {
+		return Limits{}
+	}
+	return t.limits
+}
+
+func (t *Throttler) Windows() []Window {
+	if t == nil {
+		return nil
+	}
+	return t.windows
+}
+
+// InWindow reports whether background transfers may run at now.
+func (t *Throttler) InWindow(now time.Time) bool {
+	if t == nil || len(t.windows) == 0 {
+		return true
+	}
+	for _, w := range t.windows {
+		if w.Contains(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Writer paces writes to peer, the upload direction.
+func (t *Throttler) Writer(ctx context.Context, w io.Writer, peer string, class Class) io.Writer {
+	if t == nil {
+		return w
+	}
+	return &writer{ctx: ctx, w: w, wait: t.waiter(peer, class, true)}
+}
+
+// Reader paces reads from peer, the download direction.
+func (t *Throttler) Reader(ctx context.Context, r io.Reader, peer string, class Class) io.Reader {
+	if t == nil {
+		return r
+	}
+	return &reader{ctx: ctx, r: r, wait: t.waiter(peer, class, false)}
+}
+
+func (t *Throttler) waiter(peer string, class Class, upload bool) func(context.Context, int) error {
+	global, perPeer := t.download, t.peerBuckets(peer).download
+	if upload {
+		global, perPeer = t.upload, t.peerBuckets(peer).upload
+	}
+
+	return func(ctx context.Context, n int) error {
+		for _, b := range []*bucket{perPeer, global} {
+			if b == nil {
+				continue
+			}
+			if err := b.wait(ctx, n, class); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func (t *Throttler) peerBuckets(peer string) *peerBuckets {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.peers[peer]
+	if !ok {
+		p = &peerBuckets{}
+		if t.limits.PeerUpload > 0 {
+			p.upload = newBucket(t.limits.PeerUpload)
+		}
+		if t.limits.PeerDownload > 0 {
+			p.download = newBucket(t.limits.PeerDownload)
+		}
+		t.peers[peer] = p
+	}
+	return p
+}
+
+// WaitWindow blocks until a background window opens. Background transfers
+// call it before they start, once started they run to the end.
+func (t *Throttler) WaitWindow(ctx context.Context) error {
+	for !t.InWindow(time.Now()) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Minute):
+		}
+	}
+	return nil
+}
+
+type writer struct {
+	ctx  context.Context
+	w    io.Writer
+	wait func(context.Context, int) error
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), chunkSize)]
+		if err := w.wait(w.ctx, len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := w.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+type reader struct {
+	ctx  context.Context
+	r    io.Reader
+	wait func(context.Context, int) error
+}
+
+// Read pays for the bytes it got after reading them, the next read is held
+// back until they are paid for.
+func (r *reader) Read(p []byte) (int, error) {
+	if len(p) > chunkSize {
+		p = p[:chunkSize]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if werr := r.wait(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
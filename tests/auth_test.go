@@ -0,0 +1,39 @@
+package tests
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/gokul656/obscure-fs/internal/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "apikeys.json")
+	keys, err := auth.NewKeyStore(path)
+	assert.Nil(t, err)
+
+	secret, created, err := keys.Create("ci", []auth.Scope{auth.ScopeWrite})
+	assert.Nil(t, err)
+	assert.NotContains(t, created.Hash, secret)
+
+	// keys are persisted and only the hash is needed to authenticate
+	reloaded, err := auth.NewKeyStore(path)
+	assert.Nil(t, err)
+	key, ok := reloaded.Authenticate(secret)
+	assert.True(t, ok)
+	assert.True(t, key.HasScope(auth.ScopeRead))
+	assert.True(t, key.HasScope(auth.ScopeWrite))
+	assert.False(t, key.HasScope(auth.ScopeAdmin))
+
+	_, ok = reloaded.Authenticate(secret + "x")
+	assert.False(t, ok)
+
+	assert.Nil(t, reloaded.Revoke(created.ID))
+	_, ok = reloaded.Authenticate(secret)
+	assert.False(t, ok)
+	assert.NotNil(t, reloaded.Revoke(created.ID))
+
+	_, err = auth.ParseScopes([]string{"read", "root"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,59 @@
+package tests
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/gokul656/obscure-fs/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheGet(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(dir+"/leftover.part", []byte("partial"), 0644))
+
+	cache, err := storage.NewCache(dir, 0, storage.LRU)
+	assert.NoError(t, err)
+	assert.NoFileExists(t, dir+"/leftover.part")
+
+	_, ok := cache.Get("cid")
+	assert.False(t, ok)
+
+	assert.NoError(t, os.WriteFile(cache.PartialPath("cid"), []byte("content"), 0644))
+	assert.NoError(t, cache.Add("cid"))
+	path, ok := cache.Get("cid")
+	assert.True(t, ok)
+	assert.Equal(t, cache.Path("cid"), path)
+	assert.NoFileExists(t, cache.PartialPath("cid"))
+
+	assert.NoError(t, os.Remove(path))
+	_, ok = cache.Get("cid")
+	assert.False(t, ok)
+	assert.Equal(t, int64(0), cache.Usage().Used)
+}
+
+func TestCacheOpen(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := storage.NewCache(dir, 10, storage.LRU)
+	assert.NoError(t, err)
+
+	_, ok := cache.Open("cid-a")
+	assert.False(t, ok)
+
+	assert.NoError(t, os.WriteFile(cache.PartialPath("cid-a"), []byte("content"), 0644))
+	assert.NoError(t, cache.Add("cid-a"))
+	f, ok := cache.Open("cid-a")
+	if !assert.True(t, ok) {
+		return
+	}
+	defer f.Close()
+
+	// evicting the file leaves the open handle readable
+	assert.NoError(t, os.WriteFile(cache.PartialPath("cid-b"), []byte("content"), 0644))
+	assert.NoError(t, cache.Add("cid-b"))
+	assert.NoFileExists(t, cache.Path("cid-a"))
+	content, err := io.ReadAll(f)
+	assert.NoError(t, err)
+	assert.Equal(t, "content", string(content))
+}
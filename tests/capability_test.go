@@ -0,0 +1,43 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gokul656/obscure-fs/internal/capability"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapabilityToken(t *testing.T) {
+	key, pub, _ := crypto.GenerateEd25519Key(nil)
+	_, otherPub, _ := crypto.GenerateEd25519Key(nil)
+	_, audiencePub, _ := crypto.GenerateEd25519Key(nil)
+	audience, _ := peer.IDFromPublicKey(audiencePub)
+
+	token, err := capability.Issue(key, []string{"cid-a", "cid-b"}, time.Minute, "")
+	assert.Nil(t, err)
+
+	_, err = capability.Verify(pub, token, "cid-b", "")
+	assert.Nil(t, err)
+
+	_, err = capability.Verify(pub, token, "cid-c", "")
+	assert.ErrorIs(t, err, capability.ErrNotCovered)
+
+	_, err = capability.Verify(otherPub, token, "cid-a", "")
+	assert.ErrorIs(t, err, capability.ErrBadSignature)
+
+	_, err = capability.Verify(pub, token[:len(token)-4]+"AAAA", "cid-a", "")
+	assert.ErrorIs(t, err, capability.ErrBadSignature)
+
+	expired, _ := capability.Issue(key, []string{"cid-a"}, -time.Minute, "")
+	_, err = capability.Verify(pub, expired, "cid-a", "")
+	assert.ErrorIs(t, err, capability.ErrExpired)
+
+	scoped, _ := capability.Issue(key, []string{"cid-a"}, time.Minute, audience.String())
+	_, err = capability.Verify(pub, scoped, "cid-a", "")
+	assert.ErrorIs(t, err, capability.ErrAudience)
+	_, err = capability.Verify(pub, scoped, "cid-a", audience)
+	assert.Nil(t, err)
+}
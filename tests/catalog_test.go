@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/gokul656/obscure-fs/internal/networking"
+	"github.com/gokul656/obscure-fs/internal/search"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCatalog(t *testing.T) {
+	catalog := networking.NewCatalog()
+	catalog.Add(search.Document{CID: "cid-b"}, "peer-1")
+	catalog.Add(search.Document{CID: "cid-a"}, "peer-1")
+	catalog.Add(search.Document{CID: "cid-a"}, "peer-2")
+	catalog.Add(search.Document{CID: "cid-c"}, "peer-2")
+
+	page, total := catalog.List(0, 2)
+	assert.Equal(t, 3, total)
+	assert.Len(t, page, 2)
+	assert.Equal(t, "cid-a", page[0].CID)
+	assert.Equal(t, []string{"peer-1", "peer-2"}, page[0].Providers)
+
+	page, _ = catalog.List(2, 2)
+	assert.Len(t, page, 1)
+	assert.Equal(t, "cid-c", page[0].CID)
+
+	page, _ = catalog.List(10, 2)
+	assert.Empty(t, page)
+
+	catalog.Remove("cid-a", "peer-1")
+	entry, ok := catalog.Get("cid-a")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"peer-2"}, entry.Providers)
+
+	catalog.RemoveProvider("peer-2")
+	_, ok = catalog.Get("cid-a")
+	assert.False(t, ok)
+	_, total = catalog.List(0, 0)
+	assert.Equal(t, 1, total)
+}
+
+func TestCatalogSearch(t *testing.T) {
+	catalog := networking.NewCatalog()
+	catalog.Add(search.Document{CID: "cid-a", Name: "Q3-report.pdf", MIME: "application/pdf", Size: 4096, Tags: []string{"finance"}}, "peer-1")
+	catalog.Add(search.Document{CID: "cid-b", Name: "holiday.jpg", MIME: "image/jpeg", Size: 1 << 20, Tags: []string{"photos"}}, "peer-1")
+	catalog.Add(search.Document{CID: "cid-b", Name: "holiday.jpg", MIME: "image/jpeg", Size: 1 << 20, Tags: []string{"photos"}}, "peer-2")
+
+	results := catalog.Search(search.Query{Text: "rep"})
+	assert.Len(t, results, 1)
+	assert.Equal(t, "cid-a", results[0].CID)
+
+	results = catalog.Search(search.Query{Text: "holiday jpg"})
+	assert.Len(t, results, 1)
+	assert.Equal(t, []string{"peer-1", "peer-2"}, results[0].Providers)
+
+	assert.Len(t, catalog.Search(search.Query{Text: "report holiday"}), 0)
+	assert.Len(t, catalog.Search(search.Query{MIME: "image/"}), 1)
+	assert.Len(t, catalog.Search(search.Query{Tag: "Finance"}), 1)
+	assert.Len(t, catalog.Search(search.Query{MinSize: 8192}), 1)
+	assert.Len(t, catalog.Search(search.Query{}), 2)
+
+	catalog.RemoveProvider("peer-1")
+	results = catalog.Search(search.Query{Text: "holiday"})
+	assert.Equal(t, []string{"peer-2"}, results[0].Providers)
+	assert.Len(t, catalog.Search(search.Query{Text: "report"}), 0)
+}
@@ -1,8 +1,11 @@
 package tests
 
 import (
+	"context"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/gokul656/obscure-fs/internal/codec"
@@ -45,3 +48,120 @@ func TestCodec(t *testing.T) {
 
 	os.RemoveAll(filepath.Dir(outfile))
 }
+
+func TestCodecPadding(t *testing.T) {
+	filePath := "../README.md"
+	fileName := filepath.Base(filePath)
+	buf, _ := storage.ReadFile(filePath)
+
+	hash, _ := hashing.HashFile(filePath)
+	metadata := &storage.Metadata{
+		Name:     fileName,
+		Checksum: hash,
+	}
+
+	ec := codec.ErasureCodec{Padding: codec.PowerOfTwoPadding{}}
+	err := ec.Encode(metadata, buf)
+	if err != nil {
+		panic(err)
+	}
+
+	shardSize, err := storage.GetFileSize(metadata.Parts[0])
+	if err != nil {
+		panic(err)
+	}
+
+	outfile, err := ec.Decode(metadata)
+	if err != nil {
+		panic(err)
+	}
+
+	hash, err = hashing.HashFile(outfile)
+	if err != nil {
+		panic(err)
+	}
+
+	padded := codec.PowerOfTwoPadding{}.PaddedSize(len(buf))
+	assert.Equal(t, int64(padded/utils.Shards), shardSize)
+	assert.Equal(t, int64(len(buf)), metadata.Size)
+	assert.Equal(t, "pow2", metadata.Padding)
+	assert.Equal(t, metadata.Checksum, hash)
+
+	os.RemoveAll(filepath.Dir(outfile))
+}
+
+func TestPaddingPolicy(t *testing.T) {
+	policy, err := codec.ParsePaddingPolicy("bucket:4096")
+	assert.Nil(t, err)
+	assert.Equal(t, 4096, policy.PaddedSize(1))
+	assert.Equal(t, 8192, policy.PaddedSize(4097))
+
+	policy, err = codec.ParsePaddingPolicy("pow2")
+	assert.Nil(t, err)
+	assert.Equal(t, 1024, policy.PaddedSize(1000))
+	assert.Equal(t, 1024, policy.PaddedSize(1024))
+
+	_, err = codec.ParsePaddingPolicy("bogus")
+	assert.NotNil(t, err)
+}
+
+func TestSharePadded(t *testing.T) {
+	n, store := newTestNetwork(t)
+	path := filepath.Join(t.TempDir(), "content")
+	assert.NoError(t, os.WriteFile(path, make([]byte, 1000), 0644))
+
+	cid, err := n.ShareFile(context.Background(), path, storage.FileEntry{Visibility: storage.Private, Codec: storage.CodecInfo{Padding: "pow2"}}, 0)
+	assert.NoError(t, err)
+	defer os.RemoveAll(filepath.Join(utils.StoragePath, cid))
+
+	entry, err := store.GetEntry(cid)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1000), entry.Size)
+	assert.Equal(t, storage.CodecInfo{Name: codec.ErasureCodecName, Shards: utils.Shards, Parity: utils.Pairty, Padding: "pow2", PaddedSize: 1024}, entry.Codec)
+	// peers only learn the padded size
+	assert.Equal(t, int64(1024), entry.Document(cid).Size)
+	assert.Len(t, entry.Blobs, utils.Shards+utils.Pairty)
+	used := entry.Size
+	for _, blob := range entry.Blobs {
+		size, err := storage.GetFileSize(blob)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1024/utils.Shards), size)
+		used += size
+	}
+
+	// the shards count against the quota
+	assert.Equal(t, used, entry.DiskSize())
+	node, _ := store.Usage("")
+	assert.Equal(t, used, node)
+
+	// sharing the same content again keeps the stored entry
+	again := filepath.Join(t.TempDir(), "again")
+	assert.NoError(t, os.WriteFile(again, make([]byte, 1000), 0644))
+	_, err = n.ShareFile(context.Background(), again, storage.FileEntry{Visibility: storage.Public, Codec: storage.CodecInfo{Padding: "none"}}, 0)
+	assert.ErrorIs(t, err, storage.ErrFileExists)
+	kept, err := store.GetEntry(cid)
+	assert.NoError(t, err)
+	assert.Equal(t, entry, kept)
+}
+
+func TestTrimPadding(t *testing.T) {
+	// content ending in zeros keeps them
+	content := append([]byte(strings.Repeat("x", 600)), make([]byte, 100)...)
+	cid := contentCID(t, string(content))
+
+	path := filepath.Join(t.TempDir(), "padded")
+	assert.NoError(t, os.WriteFile(path, append(slices.Clone(content), make([]byte, 324)...), 0644))
+	assert.NoError(t, hashing.TrimPadding(path, cid))
+	trimmed, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, content, trimmed)
+
+	// unpadded content is left as it is
+	assert.NoError(t, hashing.TrimPadding(path, cid))
+	assert.FileExists(t, path)
+	size, _ := storage.GetFileSize(path)
+	assert.Equal(t, int64(700), size)
+
+	assert.NoError(t, os.WriteFile(path, append([]byte("other"), make([]byte, 100)...), 0644))
+	assert.ErrorContains(t, hashing.TrimPadding(path, cid), "does not match")
+}
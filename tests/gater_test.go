@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gokul656/obscure-fs/internal/networking"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGater(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gater.json")
+	allowed, _ := peer.Decode("QmeoE7T4kja3rUxrzSkFi561BxfAA3phWxFRQvAyJqpZou")
+	other, _ := peer.Decode("QmQnBnDLfbfrtCfG6HYxNek6PcG1hKLGAkDACF857Q2fvs")
+	addr := multiaddr.StringCast("/ip4/10.0.0.1/tcp/5001")
+
+	gater, err := networking.NewGater(path)
+	assert.Nil(t, err)
+	assert.True(t, gater.Allowed(other, addr))
+
+	err = gater.Add(networking.AllowList, networking.GaterRules{Peers: []string{allowed.String()}})
+	assert.Nil(t, err)
+	assert.True(t, gater.Allowed(allowed, addr))
+	assert.False(t, gater.Allowed(other, addr))
+
+	err = gater.Add(networking.DenyList, networking.GaterRules{Addrs: []string{"/ip4/10.0.0.1"}})
+	assert.Nil(t, err)
+	assert.False(t, gater.Allowed(allowed, addr))
+	assert.True(t, gater.Allowed(allowed, multiaddr.StringCast("/ip4/10.0.0.12/tcp/5001")))
+
+	err = gater.Add(networking.DenyList, networking.GaterRules{Peers: []string{"not-a-peer"}})
+	assert.NotNil(t, err)
+
+	// rules survive a restart
+	reloaded, err := networking.NewGater(path)
+	assert.Nil(t, err)
+	assert.Equal(t, gater.Rules(), reloaded.Rules())
+
+	err = reloaded.Remove(networking.DenyList, networking.GaterRules{Addrs: []string{"/ip4/10.0.0.1"}})
+	assert.Nil(t, err)
+	assert.True(t, reloaded.Allowed(allowed, addr))
+}
+
+func TestGaterSaveFailure(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "repo")
+	peerID, _ := peer.Decode("QmeoE7T4kja3rUxrzSkFi561BxfAA3phWxFRQvAyJqpZou")
+	addr := multiaddr.StringCast("/ip4/10.0.0.1/tcp/5001")
+
+	gater, err := networking.NewGater(filepath.Join(dir, "gater.json"))
+	assert.Nil(t, err)
+	assert.Nil(t, gater.Add(networking.DenyList, networking.GaterRules{Peers: []string{peerID.String()}}))
+
+	// rules that could not be saved are not applied either
+	assert.Nil(t, os.RemoveAll(dir))
+	assert.Nil(t, os.WriteFile(dir, nil, 0644))
+	assert.NotNil(t, gater.Add(networking.AllowList, networking.GaterRules{Addrs: []string{"/ip4/10.0.0.2"}}))
+	assert.NotNil(t, gater.Remove(networking.DenyList, networking.GaterRules{Peers: []string{peerID.String()}}))
+	assert.Equal(t, map[string]networking.GaterRules{
+		networking.AllowList: {},
+		networking.DenyList:  {Peers: []string{peerID.String()}},
+	}, gater.Rules())
+	assert.False(t, gater.Allowed(peerID, addr))
+}
+
+func TestGaterPartialChecks(t *testing.T) {
+	allowed, _ := peer.Decode("QmeoE7T4kja3rUxrzSkFi561BxfAA3phWxFRQvAyJqpZou")
+	other, _ := peer.Decode("QmQnBnDLfbfrtCfG6HYxNek6PcG1hKLGAkDACF857Q2fvs")
+	allowedAddr := multiaddr.StringCast("/ip4/10.0.0.1/tcp/5001")
+	otherAddr := multiaddr.StringCast("/ip4/192.168.1.1/tcp/5001")
+
+	gater, err := networking.NewGater(filepath.Join(t.TempDir(), "gater.json"))
+	assert.Nil(t, err)
+	err = gater.Add(networking.AllowList, networking.GaterRules{Peers: []string{allowed.String()}, Addrs: []string{"/ip4/10.0.0.1"}})
+	assert.Nil(t, err)
+
+	// dials and accepts only know one half, the allowed peer may come from
+	// anywhere and any peer may come from the allowed address
+	assert.True(t, gater.InterceptAccept(connAddrs{otherAddr}))
+	assert.True(t, gater.InterceptPeerDial(other))
+	assert.True(t, gater.InterceptSecured(network.DirInbound, allowed, connAddrs{otherAddr}))
+	assert.True(t, gater.InterceptSecured(network.DirInbound, other, connAddrs{allowedAddr}))
+	assert.False(t, gater.InterceptSecured(network.DirInbound, other, connAddrs{otherAddr}))
+
+	// the deny list still applies to a single half
+	err = gater.Add(networking.DenyList, networking.GaterRules{Peers: []string{other.String()}, Addrs: []string{"/ip4/192.168.1.1"}})
+	assert.Nil(t, err)
+	assert.False(t, gater.InterceptAccept(connAddrs{otherAddr}))
+	assert.False(t, gater.InterceptPeerDial(other))
+}
+
+type connAddrs struct {
+	remote multiaddr.Multiaddr
+}
+
+func (c connAddrs) LocalMultiaddr() multiaddr.Multiaddr  { return nil }
+func (c connAddrs) RemoteMultiaddr() multiaddr.Multiaddr { return c.remote }
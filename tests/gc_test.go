@@ -0,0 +1,65 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gokul656/obscure-fs/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGarbageCollection(t *testing.T) {
+	dir := t.TempDir()
+	shared := filepath.Join(dir, "shared")
+	own := filepath.Join(dir, "own")
+	assert.NoError(t, os.WriteFile(shared, []byte("shared"), 0644))
+	assert.NoError(t, os.WriteFile(own, []byte("own"), 0644))
+
+	store := storage.NewFileStore()
+	store.StoreFile("cid-pinned", storage.FileEntry{Path: shared, Pinned: true})
+	store.StoreFile("cid-shared", storage.FileEntry{Path: shared})
+	store.StoreFile("cid-own", storage.FileEntry{Path: own})
+	store.StoreFile("cid-retained", storage.FileEntry{Path: shared})
+
+	// retained like a cluster pin, without being pinned on this node
+	result := store.CollectGarbage(func(cid string) bool { return cid == "cid-retained" })
+	assert.ElementsMatch(t, []string{"cid-shared", "cid-own"}, result.Removed)
+	assert.Equal(t, 1, result.FilesReclaimed)
+	assert.FileExists(t, shared)
+	assert.NoFileExists(t, own)
+
+	_, err := store.GetEntry("cid-own")
+	assert.Error(t, err)
+	_, err = store.GetEntry("cid-retained")
+	assert.NoError(t, err)
+	_, _, err = store.Delete("cid-retained")
+	assert.NoError(t, err)
+
+	_, result, err = store.Delete("cid-pinned")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len("shared")), result.BytesReclaimed)
+	assert.NoFileExists(t, shared)
+
+	_, _, err = store.Delete("cid-pinned")
+	assert.Error(t, err)
+}
+
+func TestCachePrune(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "stale"), []byte("stale"), 0644))
+	old := time.Now().Add(-time.Hour)
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "stale"), old, old))
+
+	cache, err := storage.NewCache(dir, 0, storage.LRU)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(cache.Path("fresh"), []byte("fresh"), 0644))
+	assert.NoError(t, cache.Add("fresh"))
+
+	files, bytes := cache.Prune(time.Minute)
+	assert.Equal(t, 1, files)
+	assert.Equal(t, int64(len("stale")), bytes)
+	assert.NoFileExists(t, filepath.Join(dir, "stale"))
+	assert.FileExists(t, cache.Path("fresh"))
+}
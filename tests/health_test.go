@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gokul656/obscure-fs/internal/networking"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/assert"
+)
+
+func newPeerID(t *testing.T) peer.ID {
+	_, pub, err := crypto.GenerateEd25519Key(nil)
+	assert.NoError(t, err)
+	id, err := peer.IDFromPublicKey(pub)
+	assert.NoError(t, err)
+	return id
+}
+
+func TestPeerScoring(t *testing.T) {
+	tracker := networking.NewHealthTracker(networking.DefaultHealthPolicy)
+	fast, slow, flaky, unknown := newPeerID(t), newPeerID(t), newPeerID(t), newPeerID(t)
+
+	tracker.RecordLatency(fast, 10*time.Millisecond)
+	tracker.RecordLatency(slow, 5*time.Second)
+	tracker.RecordLatency(flaky, 10*time.Millisecond)
+	for i := 0; i < 3; i++ {
+		tracker.Record(fast, time.Second, 1<<20, nil)
+		tracker.Record(slow, time.Second, 1<<20, nil)
+	}
+	tracker.Record(flaky, time.Second, 0, errors.New("stream reset"))
+	tracker.Record(flaky, time.Second, 1<<20, nil)
+
+	assert.Equal(t, []peer.ID{fast, flaky, unknown, slow}, tracker.Rank([]peer.ID{slow, unknown, flaky, fast}))
+
+	peers := tracker.Peers()
+	assert.Equal(t, fast.String(), peers[0].Peer)
+	assert.InDelta(t, float64(1<<20), peers[0].Throughput, 1)
+	assert.Equal(t, networking.CircuitClosed, peers[0].Circuit)
+}
+
+func TestThroughputScoring(t *testing.T) {
+	tracker := networking.NewHealthTracker(networking.DefaultHealthPolicy)
+	wide, narrow := newPeerID(t), newPeerID(t)
+
+	// same latency and record, one moves a MiB in 100ms, the other in 2s
+	for _, id := range []peer.ID{wide, narrow} {
+		tracker.RecordLatency(id, 20*time.Millisecond)
+	}
+	for i := 0; i < 3; i++ {
+		tracker.Record(narrow, 2*time.Second, 1<<20, nil)
+		tracker.Record(wide, 100*time.Millisecond, 1<<20, nil)
+	}
+
+	assert.Equal(t, []peer.ID{wide, narrow}, tracker.Rank([]peer.ID{narrow, wide}))
+	peers := tracker.Peers()
+	assert.Equal(t, wide.String(), peers[0].Peer)
+	assert.Greater(t, peers[0].Score, peers[1].Score)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	policy := networking.DefaultHealthPolicy
+	policy.FailureThreshold = 2
+	policy.Cooldown = 50 * time.Millisecond
+	tracker := networking.NewHealthTracker(policy)
+	id := newPeerID(t)
+
+	failure := errors.New("timeout")
+	tracker.Record(id, time.Second, 0, failure)
+	assert.True(t, tracker.Allow(id))
+	tracker.Record(id, time.Second, 0, failure)
+	assert.False(t, tracker.Allow(id))
+	assert.Empty(t, tracker.Rank([]peer.ID{id}))
+
+	// after the cooldown a single probe goes through, failing it reopens
+	time.Sleep(policy.Cooldown)
+	assert.True(t, tracker.Allow(id))
+	assert.False(t, tracker.Allow(id))
+	tracker.Record(id, time.Second, 0, failure)
+	assert.False(t, tracker.Allow(id))
+
+	time.Sleep(policy.Cooldown)
+	assert.True(t, tracker.Allow(id))
+	tracker.Record(id, time.Second, 1024, nil)
+	assert.True(t, tracker.Allow(id))
+	assert.True(t, tracker.Allow(id))
+	assert.Equal(t, networking.CircuitClosed, tracker.Peers()[0].Circuit)
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := networking.HealthPolicy{BaseBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for attempt, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second} {
+		backoff := policy.Backoff(attempt)
+		assert.LessOrEqual(t, backoff, want)
+		assert.GreaterOrEqual(t, backoff, want*3/4)
+	}
+	assert.LessOrEqual(t, policy.Backoff(100), time.Second)
+}
+
+func TestAbandonedProbe(t *testing.T) {
+	policy := networking.DefaultHealthPolicy
+	policy.FailureThreshold = 1
+	policy.Cooldown = 50 * time.Millisecond
+	tracker := networking.NewHealthTracker(policy)
+	id := newPeerID(t)
+
+	tracker.Record(id, time.Second, 0, errors.New("timeout"))
+	time.Sleep(policy.Cooldown)
+	assert.True(t, tracker.Allow(id))
+	assert.False(t, tracker.Allow(id))
+
+	// a probe the caller gave up on frees the slot without counting
+	tracker.Abandon(id)
+	assert.True(t, tracker.Allow(id))
+	peers := tracker.Peers()
+	assert.Equal(t, 1, peers[0].Failures)
+	assert.Equal(t, networking.CircuitHalfOpen, peers[0].Circuit)
+}
@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gokul656/obscure-fs/internal/networking"
+	"github.com/gokul656/obscure-fs/utils"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLedger(t *testing.T) {
+	_, pub, _ := crypto.GenerateEd25519Key(nil)
+	id, _ := peer.IDFromPublicKey(pub)
+	path := filepath.Join(t.TempDir(), "ledger.json")
+
+	ledger, err := networking.NewLedger(path)
+	assert.NoError(t, err)
+	ledger.Reporter().LogSentMessageStream(1000, "/test", id)
+	ledger.Reporter().LogRecvMessageStream(100, "/test", id)
+
+	// the reporter updates its totals about every second
+	assert.Eventually(t, func() bool { return ledger.Get(id).Sent == 1000 }, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, int64(100), ledger.Get(id).Received)
+
+	// syncing twice does not count the same bytes again
+	ledger.Sync()
+	ledger.Sync()
+	ledger.Reporter().LogSentMessageStream(500, "/test", id)
+	assert.Eventually(t, func() bool { return ledger.Get(id).Sent == 1500 }, 5*time.Second, 50*time.Millisecond)
+	ledger.Sync()
+
+	// totals carry over to the counters of the next run
+	reloaded, err := networking.NewLedger(path)
+	assert.NoError(t, err)
+	entries := reloaded.Entries()
+	assert.Len(t, entries, 1)
+	assert.Equal(t, int64(1500), entries[0].Sent)
+	assert.Equal(t, int64(100), entries[0].Received)
+	reloaded.Reporter().LogRecvMessageStream(50, "/test", id)
+	assert.Eventually(t, func() bool { return reloaded.Get(id).Received == 150 }, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestTitForTat(t *testing.T) {
+	policy := networking.TitForTat{Ratio: 0.5, Grace: 1000}
+
+	assert.False(t, policy.Freeloader(networking.LedgerEntry{Sent: 1000}), "within grace")
+	assert.True(t, policy.Freeloader(networking.LedgerEntry{Sent: 2000, Received: 500}))
+	assert.False(t, policy.Freeloader(networking.LedgerEntry{Sent: 2000, Received: 1000}))
+	assert.False(t, networking.TitForTat{}.Freeloader(networking.LedgerEntry{Sent: 2000}), "disabled")
+}
+
+func TestLedgerProtocols(t *testing.T) {
+	policy := networking.TitForTat{Ratio: 0.5, Grace: 1000}
+	newPeer := func() peer.ID {
+		_, pub, _ := crypto.GenerateEd25519Key(nil)
+		id, _ := peer.IDFromPublicKey(pub)
+		return id
+	}
+
+	ledger, err := networking.NewLedger("")
+	assert.NoError(t, err)
+	reporter := ledger.Reporter()
+
+	// a peer holding replicas for this node gave back its fair share of
+	// retrievals, the replicas pushed to it do not make it a freeloader
+	holder := newPeer()
+	reporter.LogSentMessageStream(10000, utils.ReplicaProtocolID, holder)
+	reporter.LogSentMessageStream(2000, utils.ProtocolID, holder)
+	reporter.LogRecvMessageStream(1000, utils.ProtocolID, holder)
+
+	// answering proofs does not make up for the retrievals a peer took
+	taker := newPeer()
+	reporter.LogSentMessageStream(2000, utils.ProtocolID, taker)
+	reporter.LogRecvMessageStream(5000, utils.ProofProtocolID, taker)
+	reporter.LogRecvMessageStream(500, utils.ProtocolID, taker)
+
+	assert.Eventually(t, func() bool {
+		return ledger.Get(holder).Received == 1000 && ledger.Get(taker).Received == 500
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, int64(2000), ledger.Get(holder).Sent)
+	assert.Equal(t, int64(2000), ledger.Get(taker).Sent)
+	assert.False(t, policy.Freeloader(ledger.Get(holder)))
+	assert.True(t, policy.Freeloader(ledger.Get(taker)))
+}
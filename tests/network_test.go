@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gokul656/obscure-fs/internal/networking"
+	"github.com/gokul656/obscure-fs/internal/storage"
+	"github.com/gokul656/obscure-fs/utils"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestNetwork starts a node on a random local port with the protocols
+// serve starts, it is shut down with the test.
+func newTestNetwork(t *testing.T, opts ...networking.Option) (*networking.Network, *storage.FileStore) {
+	ctx, cancel := context.WithCancel(context.Background())
+	store := storage.NewFileStore()
+	n := networking.NewNetwork(ctx, 0, "", nil, store, opts...)
+	n.StartSimpleProtocol(utils.ProtocolID)
+	n.StartReplicaProtocol()
+	n.StartProofProtocol()
+	t.Cleanup(func() {
+		cancel()
+		n.Shutdown()
+		os.RemoveAll(filepath.Join(utils.TempPath, n.GetHost().ID().String()))
+		os.Remove(utils.TempPath)
+	})
+	return n, store
+}
+
+func connect(t *testing.T, from, to *networking.Network) {
+	host := to.GetHost()
+	assert.NoError(t, from.GetHost().Connect(context.Background(), peer.AddrInfo{ID: host.ID(), Addrs: host.Addrs()}))
+}
+
+// request sends command over protocolID and returns the whole reply.
+func request(t *testing.T, from, to *networking.Network, protocolID protocol.ID, command string) []byte {
+	stream, err := from.GetHost().NewStream(context.Background(), to.GetHost().ID(), protocolID)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	defer stream.Close()
+
+	_, err = stream.Write([]byte(command))
+	assert.NoError(t, err)
+	stream.CloseWrite()
+	reply, _ := io.ReadAll(stream)
+	return reply
+}
+
+// storeContent stores content on store under cid as-is, without announcing
+// it.
+func storeContent(t *testing.T, store *storage.FileStore, cid, content string, entry storage.FileEntry) {
+	entry.Path = filepath.Join(t.TempDir(), cid)
+	entry.Size = int64(len(content))
+	assert.NoError(t, os.WriteFile(entry.Path, []byte(content), 0644))
+	assert.NoError(t, store.StoreFile(cid, entry))
+}
+
+// cleanupReplica removes the copy of cid test networks received, they all
+// share the replica directory.
+func cleanupReplica(t *testing.T, cid string) {
+	t.Cleanup(func() {
+		os.Remove(filepath.Join(utils.ReplicaPath, cid))
+		os.Remove(utils.ReplicaPath)
+	})
+}
@@ -0,0 +1,163 @@
+package tests
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gokul656/obscure-fs/internal/networking"
+	"github.com/gokul656/obscure-fs/internal/pinset"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPinSetConverges(t *testing.T) {
+	a, err := pinset.NewSet("")
+	assert.NoError(t, err)
+	b, err := pinset.NewSet("")
+	assert.NoError(t, err)
+
+	pinned, err := a.Update(pinset.Pin{CID: "cid-1", Replicas: 2, Pinned: true, Author: "a"})
+	assert.NoError(t, err)
+	_, err = b.Update(pinset.Pin{CID: "cid-2", Replicas: 1, Pinned: true, Author: "b"})
+	assert.NoError(t, err)
+
+	// b unpins after seeing the pin of a, a hears about it before the pin
+	// comes back around
+	_, err = b.Merge([]pinset.Pin{pinned})
+	assert.NoError(t, err)
+	unpinned, err := b.Update(pinset.Pin{CID: "cid-1", Author: "b"})
+	assert.NoError(t, err)
+	_, err = a.Merge([]pinset.Pin{unpinned})
+	assert.NoError(t, err)
+
+	changed, err := a.Merge([]pinset.Pin{pinned})
+	assert.NoError(t, err)
+	assert.Empty(t, changed)
+
+	_, err = a.Merge(b.All())
+	assert.NoError(t, err)
+	_, err = b.Merge(a.All())
+	assert.NoError(t, err)
+
+	assert.Equal(t, a.All(), b.All())
+	assert.False(t, a.IsPinned("cid-1"))
+	assert.True(t, a.IsPinned("cid-2"))
+	assert.Len(t, a.All(), 2)
+}
+
+func TestPinSetConcurrentUpdates(t *testing.T) {
+	pins := []pinset.Pin{
+		{CID: "cid", Pinned: true, Clock: 5, Author: "a"},
+		{CID: "cid", Pinned: false, Clock: 5, Author: "b"},
+		{CID: "cid", Pinned: true, Clock: 3, Author: "c"},
+	}
+
+	// the same winner whatever the order the updates arrive in
+	for _, order := range [][]int{{0, 1, 2}, {2, 1, 0}, {1, 2, 0}} {
+		s, err := pinset.NewSet("")
+		assert.NoError(t, err)
+		for _, i := range order {
+			_, err := s.Merge([]pinset.Pin{pins[i]})
+			assert.NoError(t, err)
+		}
+
+		p, ok := s.Get("cid")
+		assert.True(t, ok)
+		assert.Equal(t, "b", p.Author)
+		assert.False(t, s.IsPinned("cid"))
+	}
+}
+
+func TestPinSetExpiryAndPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pins.json")
+	s, err := pinset.NewSet(path)
+	assert.NoError(t, err)
+
+	// as it reads back from JSON
+	now := time.Now().UTC().Round(0)
+	_, err = s.Update(pinset.Pin{CID: "expiring", Pinned: true, Expires: now.Add(time.Minute)})
+	assert.NoError(t, err)
+	remote, err := s.Update(pinset.Pin{CID: "forever", Pinned: true})
+	assert.NoError(t, err)
+
+	assert.Len(t, s.Active(now), 2)
+	assert.Len(t, s.Active(now.Add(2*time.Minute)), 1)
+
+	loaded, err := pinset.NewSet(path)
+	assert.NoError(t, err)
+	assert.Equal(t, s.All(), loaded.All())
+
+	// the clock carries on from the persisted pins
+	next, err := loaded.Update(pinset.Pin{CID: "forever"})
+	assert.NoError(t, err)
+	assert.Greater(t, next.Clock, remote.Clock)
+}
+
+func TestPinSetFutureClocks(t *testing.T) {
+	s, err := pinset.NewSet("")
+	assert.NoError(t, err)
+
+	// a clock far ahead would win over every later update
+	future := pinset.Pin{CID: "cid", Pinned: true, Clock: time.Now().Add(time.Hour).UnixNano(), Author: "a"}
+	changed, err := s.Merge([]pinset.Pin{future})
+	assert.NoError(t, err)
+	assert.Empty(t, changed)
+	_, ok := s.Get("cid")
+	assert.False(t, ok)
+
+	// a peer slightly ahead is still heard, and updates carry on after it
+	ahead := pinset.Pin{CID: "cid", Pinned: true, Clock: time.Now().Add(time.Second).UnixNano(), Author: "a"}
+	changed, err = s.Merge([]pinset.Pin{ahead})
+	assert.NoError(t, err)
+	assert.Len(t, changed, 1)
+
+	unpinned, err := s.Update(pinset.Pin{CID: "cid", Author: "b"})
+	assert.NoError(t, err)
+	assert.Greater(t, unpinned.Clock, ahead.Clock)
+	assert.False(t, s.IsPinned("cid"))
+}
+
+// pinNode starts a gateway node syncing cluster pins, gateways never fetch
+// the pinned files.
+func pinNode(t *testing.T) *networking.Network {
+	n, _ := newTestNetwork(t, networking.WithProfile(networking.Profile{Role: networking.RoleGateway}))
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	pins, err := pinset.NewSet("")
+	assert.NoError(t, err)
+	assert.NoError(t, n.StartClusterPins(ctx, pins, 200*time.Millisecond))
+	return n
+}
+
+func TestClusterPinsOutliveAuthor(t *testing.T) {
+	pinned, unpinned, forged := contentCID(t, "pinned"), contentCID(t, "unpinned"), contentCID(t, "forged")
+	a, b := pinNode(t), pinNode(t)
+	connect(t, a, b)
+
+	_, err := a.PinCluster(pinset.Pin{CID: pinned, Replicas: 2})
+	assert.NoError(t, err)
+	_, err = a.PinCluster(pinset.Pin{CID: unpinned, Replicas: 2})
+	assert.NoError(t, err)
+	_, err = a.UnpinCluster(unpinned)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		p, ok := b.Pins().Get(unpinned)
+		return b.Pins().IsPinned(pinned) && ok && !p.Pinned
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// b holds a pin it made up in a's name
+	_, err = b.Pins().Merge([]pinset.Pin{{CID: forged, Replicas: 2, Pinned: true, Clock: time.Now().UnixNano(), Author: a.GetHost().ID().String(), Signature: []byte("forged")}})
+	assert.NoError(t, err)
+
+	// a node joining after a left still learns a's pin and tombstone from b
+	a.Shutdown()
+	c := pinNode(t)
+	connect(t, c, b)
+	assert.Eventually(t, func() bool {
+		p, ok := c.Pins().Get(unpinned)
+		return c.Pins().IsPinned(pinned) && ok && !p.Pinned
+	}, 10*time.Second, 50*time.Millisecond)
+	_, ok := c.Pins().Get(forged)
+	assert.False(t, ok)
+}
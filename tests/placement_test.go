@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gokul656/obscure-fs/internal/placement"
+	"github.com/stretchr/testify/assert"
+)
+
+func ids(candidates []placement.Candidate) []string {
+	out := make([]string, len(candidates))
+	for i, c := range candidates {
+		out[i] = c.ID
+	}
+	return out
+}
+
+func TestRendezvousPlacement(t *testing.T) {
+	candidates := []placement.Candidate{{ID: "a"}, {ID: "b"}, {ID: "c"}, {ID: "d"}}
+	strategy := placement.Rendezvous{}
+
+	ranked := strategy.Rank("cid", candidates, nil)
+	assert.Len(t, ranked, 4)
+	assert.Equal(t, ids(ranked), ids(strategy.Rank("cid", []placement.Candidate{candidates[3], candidates[1], candidates[0], candidates[2]}, nil)))
+
+	// removing a node only moves the keys it held
+	without := strategy.Rank("cid", []placement.Candidate{candidates[0], candidates[1], candidates[2]}, nil)
+	expected := []string{}
+	for _, id := range ids(ranked) {
+		if id != "d" {
+			expected = append(expected, id)
+		}
+	}
+	assert.Equal(t, expected, ids(without))
+}
+
+func TestRendezvousWeights(t *testing.T) {
+	candidates := []placement.Candidate{
+		{ID: "small", Capacity: 10, Free: 10},
+		{ID: "large", Capacity: 90, Free: 10},
+	}
+
+	first := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("cid-%d", i)
+		ranked := placement.Rendezvous{}.Rank(key, candidates, nil)
+		first[ranked[0].ID]++
+
+		// free space moves with every upload, it must not move keys
+		filled := []placement.Candidate{candidates[0], {ID: "large", Capacity: 90, Free: 1}}
+		assert.Equal(t, ids(ranked), ids(placement.Rendezvous{}.Rank(key, filled, nil)))
+	}
+	assert.Greater(t, first["large"], 800)
+}
+
+func TestCandidateAdmits(t *testing.T) {
+	assert.True(t, placement.Candidate{Capacity: 100, Free: 10}.Admits(10))
+	assert.False(t, placement.Candidate{Capacity: 100, Free: 10}.Admits(11))
+	assert.False(t, placement.Candidate{Capacity: 100}.Admits(1))
+	// nodes that advertise no capacity are always admitted
+	assert.True(t, placement.Candidate{}.Admits(1<<40))
+}
+
+func TestRendezvousZones(t *testing.T) {
+	candidates := []placement.Candidate{
+		{ID: "a1", Zone: "a"}, {ID: "a2", Zone: "a"}, {ID: "a3", Zone: "a"},
+		{ID: "b1", Zone: "b"}, {ID: "c1", Zone: "c"},
+	}
+
+	for i := 0; i < 20; i++ {
+		ranked := placement.Rendezvous{}.Rank(fmt.Sprintf("cid-%d", i), candidates, []string{"a"})
+		zones := []string{ranked[0].Zone, ranked[1].Zone}
+		assert.ElementsMatch(t, []string{"b", "c"}, zones)
+		assert.Equal(t, "a", ranked[2].Zone)
+	}
+}
+
+func TestParsePlacement(t *testing.T) {
+	strategy, err := placement.Parse("")
+	assert.NoError(t, err)
+	assert.Equal(t, "rendezvous", strategy.String())
+
+	strategy, err = placement.Parse("random")
+	assert.NoError(t, err)
+	assert.Len(t, strategy.Rank("cid", []placement.Candidate{{ID: "a"}, {ID: "b"}}, nil), 2)
+
+	_, err = placement.Parse("nearest")
+	assert.Error(t, err)
+}
@@ -0,0 +1,160 @@
+package tests
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/gokul656/obscure-fs/internal/networking"
+	"github.com/gokul656/obscure-fs/internal/storage"
+	"github.com/gokul656/obscure-fs/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+type proofReply struct {
+	Hashes []string `json:"hashes"`
+	Error  string   `json:"error"`
+}
+
+// challenge sends a raw storage challenge for cid and returns the reply.
+func challenge(t *testing.T, from, to *networking.Network, cid string, nonce []byte, ranges []networking.ByteRange) proofReply {
+	data, _ := json.Marshal(map[string]any{"cid": cid, "nonce": nonce, "ranges": ranges})
+	var reply proofReply
+	assert.NoError(t, json.Unmarshal(request(t, from, to, utils.ProofProtocolID, string(data)+"\n"), &reply))
+	return reply
+}
+
+func TestProveRanges(t *testing.T) {
+	a, _ := newTestNetwork(t)
+	b, store := newTestNetwork(t)
+	connect(t, a, b)
+
+	content := strings.Repeat("0123456789", 1000)
+	cid := contentCID(t, content)
+	storeContent(t, store, cid, content, storage.FileEntry{Visibility: storage.Private, Holders: []string{a.GetHost().ID().String()}})
+
+	nonce := []byte("nonce")
+	ranges := []networking.ByteRange{{Offset: 0, Length: 4096}, {Offset: 10000 - 4096, Length: 4096}, {Offset: 10, Length: 5000}}
+	reply := challenge(t, a, b, cid, nonce, ranges)
+	assert.Empty(t, reply.Error)
+
+	// each range is hashed on its own, behind the nonce and the prover
+	var expected []string
+	for _, r := range ranges {
+		sum := sha256.Sum256([]byte(string(nonce) + string(b.GetHost().ID()) + content[r.Offset:r.Offset+r.Length]))
+		expected = append(expected, hex.EncodeToString(sum[:]))
+	}
+	assert.Equal(t, expected, reply.Hashes)
+
+	// another holder's answer does not pass for b's
+	c, storeC := newTestNetwork(t)
+	connect(t, a, c)
+	storeContent(t, storeC, cid, content, storage.FileEntry{Visibility: storage.Private, Holders: []string{a.GetHost().ID().String()}})
+	relayed := challenge(t, a, c, cid, nonce, ranges)
+	assert.Empty(t, relayed.Error)
+	assert.Len(t, relayed.Hashes, len(ranges))
+	for i := range ranges {
+		assert.NotEqual(t, reply.Hashes[i], relayed.Hashes[i])
+	}
+}
+
+func TestProofRangeChecks(t *testing.T) {
+	a, _ := newTestNetwork(t)
+	b, store := newTestNetwork(t)
+	connect(t, a, b)
+
+	content := strings.Repeat("0123456789", 1000)
+	cid := contentCID(t, content)
+	storeContent(t, store, cid, content, storage.FileEntry{Visibility: storage.Private, Holders: []string{a.GetHost().ID().String()}})
+
+	size := int64(len(content))
+	for _, ranges := range [][]networking.ByteRange{
+		{{Offset: size - 4095, Length: 4096}},
+		{{Offset: -1, Length: 4096}},
+		{{Offset: 0, Length: -1}},
+		{{Offset: 0, Length: 65<<10 + 1}},
+		// ranges too short to be brute-forced are refused, the tail of the
+		// file included
+		{{Offset: 0, Length: 1}},
+		{{Offset: 100, Length: 4095}},
+		{{Offset: size - 1, Length: 1}},
+	} {
+		reply := challenge(t, a, b, cid, []byte("nonce"), ranges)
+		assert.Equal(t, "invalid range", reply.Error, "%+v", ranges)
+		assert.Empty(t, reply.Hashes)
+	}
+
+	reply := challenge(t, a, b, cid, []byte("nonce"), make([]networking.ByteRange, 65))
+	assert.Equal(t, "too many ranges", reply.Error)
+
+	// a file smaller than a range is only hashed whole
+	small := "a small file"
+	smallCID := contentCID(t, small)
+	storeContent(t, store, smallCID, small, storage.FileEntry{Visibility: storage.Private, Holders: []string{a.GetHost().ID().String()}})
+	reply = challenge(t, a, b, smallCID, []byte("nonce"), []networking.ByteRange{{Offset: 1, Length: int64(len(small)) - 1}})
+	assert.Equal(t, "invalid range", reply.Error)
+	reply = challenge(t, a, b, smallCID, []byte("nonce"), []networking.ByteRange{{Offset: 0, Length: int64(len(small))}})
+	assert.Empty(t, reply.Error)
+	assert.Len(t, reply.Hashes, 1)
+}
+
+func TestProofChallengers(t *testing.T) {
+	holder, _ := newTestNetwork(t)
+	stranger, _ := newTestNetwork(t)
+	b, store := newTestNetwork(t)
+	connect(t, holder, b)
+	connect(t, stranger, b)
+
+	content := strings.Repeat("private content ", 500)
+	cid := contentCID(t, content)
+	storeContent(t, store, cid, content, storage.FileEntry{Visibility: storage.Private, Holders: []string{holder.GetHost().ID().String()}})
+	ranges := []networking.ByteRange{{Offset: 0, Length: 4096}}
+
+	assert.Empty(t, challenge(t, holder, b, cid, []byte("nonce"), ranges).Error)
+
+	// a peer that may not know of a private file is told it is not stored
+	reply := challenge(t, stranger, b, cid, []byte("nonce"), ranges)
+	assert.Equal(t, "CID: "+cid+" is not stored", reply.Error)
+	assert.Empty(t, reply.Hashes)
+
+	// the content of public files may be read by anyone anyway
+	public := strings.Repeat("public content ", 500)
+	publicCID := contentCID(t, public)
+	storeContent(t, store, publicCID, public, storage.FileEntry{Visibility: storage.Public})
+	assert.Empty(t, challenge(t, stranger, b, publicCID, []byte("nonce"), ranges).Error)
+}
+
+func TestChallenge(t *testing.T) {
+	content := strings.Repeat("stored content ", 1000)
+	cid := contentCID(t, content)
+
+	a, storeA := newTestNetwork(t)
+	storeContent(t, storeA, cid, content, storage.FileEntry{Visibility: storage.Private})
+	entry, _ := storeA.GetEntry(cid)
+	// the copies were pushed by a
+	pushed := storage.FileEntry{Visibility: storage.Private, Uploader: "peer " + a.GetHost().ID().String()}
+
+	honest, storeHonest := newTestNetwork(t)
+	storeContent(t, storeHonest, cid, content, pushed)
+	// same size, other bytes
+	cheat, storeCheat := newTestNetwork(t)
+	storeContent(t, storeCheat, cid, strings.ToUpper(content), pushed)
+	empty, _ := newTestNetwork(t)
+
+	for _, n := range []*networking.Network{honest, cheat, empty} {
+		connect(t, a, n)
+	}
+
+	assert.NoError(t, a.Challenge(context.Background(), honest.GetHost().ID(), cid, entry))
+
+	err := a.Challenge(context.Background(), cheat.GetHost().ID(), cid, entry)
+	assert.ErrorIs(t, err, networking.ErrProofFailed)
+	assert.ErrorContains(t, err, "wrong hashes")
+
+	err = a.Challenge(context.Background(), empty.GetHost().ID(), cid, entry)
+	assert.ErrorIs(t, err, networking.ErrProofFailed)
+	assert.ErrorContains(t, err, "is not stored")
+}
@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"os"
+	"testing"
+
+	"github.com/gokul656/obscure-fs/internal/storage"
+	"github.com/gokul656/obscure-fs/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuota(t *testing.T) {
+	store := storage.NewFileStore()
+	store.SetQuota(storage.Quota{Node: 100, PerUploader: 60})
+
+	assert.NoError(t, store.StoreFile("cid-a", storage.FileEntry{Size: 50, Uploader: "alice"}))
+	assert.NoError(t, store.CheckQuota("alice", 0, 10))
+	assert.ErrorIs(t, store.CheckQuota("alice", 0, 20), storage.ErrQuotaExceeded)
+	assert.NoError(t, store.CheckQuota("alice", 80, 20))
+	assert.NoError(t, store.CheckQuota("bob", 0, 50))
+
+	err := store.CheckQuota("bob", 0, 51)
+	var quotaErr *storage.QuotaError
+	assert.ErrorAs(t, err, &quotaErr)
+	assert.Equal(t, "node", quotaErr.Scope)
+
+	// storing the same CID again keeps the first entry
+	assert.ErrorIs(t, store.StoreFile("cid-a", storage.FileEntry{Size: 100, Uploader: "bob"}), storage.ErrFileExists)
+	entry, err := store.GetEntry("cid-a")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", entry.Uploader)
+
+	// the uploader's limit is checked as the file is stored
+	assert.ErrorIs(t, store.StoreFile("cid-b", storage.FileEntry{Size: 20, Uploader: "alice"}), storage.ErrQuotaExceeded)
+	assert.ErrorIs(t, store.StoreFileWithin("cid-b", storage.FileEntry{Size: 20, Uploader: "alice"}, 60), storage.ErrQuotaExceeded)
+	assert.NoError(t, store.StoreFileWithin("cid-b", storage.FileEntry{Size: 20, Uploader: "alice"}, 80))
+	assert.ErrorIs(t, store.StoreFile("cid-c", storage.FileEntry{Size: 40}), storage.ErrQuotaExceeded)
+
+	node, alice := store.Usage("alice")
+	assert.Equal(t, int64(70), node)
+	assert.Equal(t, int64(70), alice)
+}
+
+func TestCacheEviction(t *testing.T) {
+	for _, tc := range []struct {
+		policy  storage.EvictionPolicy
+		evicted string
+	}{
+		{storage.LRU, "a"},
+		{storage.LFU, "b"},
+	} {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			cache, err := storage.NewCache(t.TempDir(), 20, tc.policy)
+			assert.NoError(t, err)
+
+			add := func(cid string) {
+				assert.NoError(t, os.WriteFile(cache.Path(cid), make([]byte, 8), 0644))
+				assert.NoError(t, cache.Add(cid))
+			}
+			add("a")
+			add("a")
+			add("b")
+			add("c")
+
+			assert.NoFileExists(t, cache.Path(tc.evicted))
+			usage := cache.Usage()
+			assert.Equal(t, int64(16), usage.Used)
+			assert.Equal(t, 2, usage.Files)
+		})
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for in, want := range map[string]int64{"": 0, "512": 512, "64KB": 64 << 10, "10gb": 10 << 30, "1 MiB": 1 << 20} {
+		got, err := utils.ParseSize(in)
+		assert.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+
+	for _, in := range []string{"ten", "10XB", "-1"} {
+		_, err := utils.ParseSize(in)
+		assert.Error(t, err, in)
+	}
+}
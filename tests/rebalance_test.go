@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gokul656/obscure-fs/internal/networking"
+	"github.com/gokul656/obscure-fs/internal/storage"
+	"github.com/gokul656/obscure-fs/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// rebalanceCluster connects a to two storage peers, and returns the peer
+// placement prefers for cid first.
+func rebalanceCluster(t *testing.T, cid string, opts ...networking.Option) (a *networking.Network, storeA *storage.FileStore, nodes map[string]*networking.Network, stores map[string]*storage.FileStore, target, other string) {
+	a, storeA = newTestNetwork(t, append(opts, networking.WithPrivateReplication())...)
+	nodes = make(map[string]*networking.Network)
+	stores = make(map[string]*storage.FileStore)
+	for i := 0; i < 2; i++ {
+		n, store := newTestNetwork(t)
+		connect(t, a, n)
+		nodes[n.GetHost().ID().String()] = n
+		stores[n.GetHost().ID().String()] = store
+	}
+	assert.Eventually(t, func() bool {
+		return len(a.Placement(cid).Candidates) == 2
+	}, 5*time.Second, 100*time.Millisecond)
+
+	candidates := a.Placement(cid).Candidates
+	return a, storeA, nodes, stores, candidates[0].ID, candidates[1].ID
+}
+
+func TestRebalanceSwap(t *testing.T) {
+	content := "rebalanced content"
+	cid := contentCID(t, content)
+	cleanupReplica(t, cid)
+	a, storeA, nodes, stores, target, other := rebalanceCluster(t, cid)
+	storeContent(t, storeA, cid, content, storage.FileEntry{Visibility: storage.Private, Replicas: 2})
+
+	// the copy sits on the peer placement no longer prefers
+	replies := offerReplica(t, a, nodes[other], cid, content)
+	if assert.Len(t, replies, 2) {
+		assert.Equal(t, "stored", replies[1].Status)
+	}
+	storeA.SetHolders(cid, []string{other})
+
+	assert.NoError(t, a.Rebalance(context.Background()))
+	status := a.RebalanceStatus()
+	assert.Equal(t, 1, status.Planned)
+	assert.Equal(t, 1, status.Completed)
+
+	entry, _ := storeA.GetEntry(cid)
+	assert.Equal(t, []string{target}, entry.Holders)
+	_, err := stores[target].GetEntry(cid)
+	assert.NoError(t, err)
+	_, err = stores[other].GetEntry(cid)
+	assert.Error(t, err)
+
+	// placement matches the holders now
+	assert.NoError(t, a.Rebalance(context.Background()))
+	assert.Equal(t, 0, a.RebalanceStatus().Planned)
+}
+
+func TestRebalanceFill(t *testing.T) {
+	// twice what the budget allows per second, past the burst of one chunk
+	content := strings.Repeat("x", 64<<10)
+	cid := contentCID(t, content)
+	cleanupReplica(t, cid)
+	a, storeA, _, stores, target, other := rebalanceCluster(t, cid, networking.WithRebalanceBandwidth(32<<10))
+	storeContent(t, storeA, cid, content, storage.FileEntry{Visibility: storage.Private, Replicas: 2})
+
+	started := time.Now()
+	assert.NoError(t, a.Rebalance(context.Background()))
+	assert.GreaterOrEqual(t, time.Since(started), 900*time.Millisecond)
+
+	status := a.RebalanceStatus()
+	assert.Equal(t, 1, status.Planned)
+	assert.Equal(t, 1, status.Completed)
+	assert.Equal(t, int64(len(content)), status.BytesMoved)
+	_, err := stores[target].GetEntry(cid)
+	assert.NoError(t, err)
+	_, err = stores[other].GetEntry(cid)
+	assert.Error(t, err)
+}
+
+func TestRebalanceHeld(t *testing.T) {
+	content := "content the target already holds"
+	cid := contentCID(t, content)
+	cleanupReplica(t, cid)
+	a, storeA, nodes, _, target, _ := rebalanceCluster(t, cid)
+	storeContent(t, storeA, cid, content, storage.FileEntry{Visibility: storage.Private, Replicas: 2})
+
+	// the target holds a copy this node does not know about
+	replies := offerReplica(t, a, nodes[target], cid, content)
+	if assert.Len(t, replies, 2) {
+		assert.Equal(t, "stored", replies[1].Status)
+	}
+	storeA.SetHolders(cid, nil)
+
+	assert.NoError(t, a.Rebalance(context.Background()))
+	status := a.RebalanceStatus()
+	assert.Equal(t, 1, status.Completed)
+	assert.Equal(t, int64(len(content)), status.BytesPlanned)
+	assert.Zero(t, status.BytesMoved)
+
+	entry, _ := storeA.GetEntry(cid)
+	assert.Equal(t, []string{target}, entry.Holders)
+}
+
+func TestReleaseReplica(t *testing.T) {
+	content := "released content"
+	cid := contentCID(t, content)
+
+	a, _ := newTestNetwork(t)
+	b, store := newTestNetwork(t)
+	d, _ := newTestNetwork(t)
+	connect(t, a, b)
+	connect(t, d, b)
+
+	drop, _ := json.Marshal(map[string]any{"cid": cid, "drop": true})
+	dropFrom := func(from *networking.Network) string {
+		return string(request(t, from, b, utils.ReplicaProtocolID, string(drop)+"\n"))
+	}
+
+	// files uploaded to the node itself are never dropped for a peer
+	own := contentCID(t, "own content")
+	storeContent(t, store, own, "own content", storage.FileEntry{Visibility: storage.Private, Holders: []string{a.GetHost().ID().String()}})
+	ownDrop, _ := json.Marshal(map[string]any{"cid": own, "drop": true})
+	assert.Contains(t, string(request(t, a, b, utils.ReplicaProtocolID, string(ownDrop)+"\n")), "is not a replica")
+	_, err := store.GetEntry(own)
+	assert.NoError(t, err)
+
+	replies := offerReplica(t, a, b, cid, content)
+	if assert.Len(t, replies, 2) {
+		assert.Equal(t, "stored", replies[1].Status)
+	}
+
+	// only a holder may ask for a replica to go
+	assert.Contains(t, dropFrom(d), "does not hold")
+	_, err = store.GetEntry(cid)
+	assert.NoError(t, err)
+
+	assert.Contains(t, dropFrom(a), "dropped")
+	_, err = store.GetEntry(cid)
+	assert.Error(t, err)
+}
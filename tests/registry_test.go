@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gokul656/obscure-fs/internal/networking"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignedRegistration(t *testing.T) {
+	key, pub, _ := crypto.GenerateEd25519Key(nil)
+	id, _ := peer.IDFromPublicKey(pub)
+
+	reg, err := networking.SignRegistration(key, networking.Node{ID: id.String(), Addresses: []string{"/ip4/127.0.0.1/tcp/5001"}})
+	assert.Nil(t, err)
+	assert.Nil(t, reg.Verify())
+
+	tampered := reg
+	tampered.Node.Addresses = []string{"/ip4/10.0.0.1/tcp/5001"}
+	assert.NotNil(t, tampered.Verify())
+
+	// a valid signature for another identity is not enough
+	_, otherPub, _ := crypto.GenerateEd25519Key(nil)
+	other, _ := peer.IDFromPublicKey(otherPub)
+	spoofed := reg
+	spoofed.Node.ID = other.String()
+	assert.NotNil(t, spoofed.Verify())
+}
+
+func TestNodeRegistryPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	registry, err := networking.NewNodeRegistry(path)
+	assert.Nil(t, err)
+
+	registry.RegisterNode(networking.Node{ID: "node-a", Addresses: []string{"/ip4/127.0.0.1/tcp/5001"}})
+	assert.True(t, registry.GetAllNodes()[0].IsOnline)
+
+	// nodes are remembered across restarts but must be seen again
+	reloaded, err := networking.NewNodeRegistry(path)
+	assert.Nil(t, err)
+	nodes := reloaded.GetAllNodes()
+	assert.Len(t, nodes, 1)
+	assert.Equal(t, "node-a", nodes[0].ID)
+	assert.False(t, nodes[0].IsOnline)
+}
+
+func TestNodeRegistryHeartbeats(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	registry, err := networking.NewNodeRegistry(path)
+	assert.Nil(t, err)
+
+	node := networking.Node{ID: "node-a", Addresses: []string{"/ip4/127.0.0.1/tcp/5001"}, Free: 100}
+	registry.RegisterNode(node)
+	assert.FileExists(t, path)
+
+	// a heartbeat that only moves free space is not written
+	assert.Nil(t, os.Remove(path))
+	node.Free = 50
+	registry.RegisterNode(node)
+	assert.NoFileExists(t, path)
+
+	node.Addresses = []string{"/ip4/127.0.0.1/tcp/5002"}
+	registry.RegisterNode(node)
+	assert.FileExists(t, path)
+}
+
+func TestNodeRegistryFlags(t *testing.T) {
+	registry, err := networking.NewNodeRegistry("")
+	assert.Nil(t, err)
+
+	registry.RegisterNode(networking.Node{ID: "node-a"})
+	assert.True(t, registry.Flag("node-a", "cid-1"))
+	assert.True(t, registry.IsFlagged("node-a"))
+
+	// announcements cannot clear a flag, or set one
+	registry.RegisterNode(networking.Node{ID: "node-a"})
+	assert.True(t, registry.IsFlagged("node-a"))
+	assert.Equal(t, []string{"node-a"}, registry.FailedProofs("cid-1"))
+	registry.RegisterNode(networking.Node{ID: "node-b", Flagged: true, FailedProofs: []string{"cid-1"}})
+	assert.False(t, registry.IsFlagged("node-b"))
+
+	assert.True(t, registry.Unflag("node-a"))
+	assert.False(t, registry.IsFlagged("node-a"))
+	assert.False(t, registry.Unflag("node-a"))
+	assert.Empty(t, registry.FailedProofs("cid-1"))
+
+	// nodes that never registered are not made up
+	assert.False(t, registry.Flag("node-c", "cid-1"))
+	_, ok := registry.GetNode("node-c")
+	assert.False(t, ok)
+}
+
+func TestNodeRegistryProofs(t *testing.T) {
+	registry, err := networking.NewNodeRegistry("")
+	assert.Nil(t, err)
+	registry.RegisterNode(networking.Node{ID: "node-a"})
+	registry.Flag("node-a", "cid-1")
+	registry.Flag("node-a", "cid-2")
+
+	// proving another CID does not make up for the ones failed
+	assert.False(t, registry.PassedProof("node-a", "cid-3"))
+	assert.False(t, registry.PassedProof("node-a", "cid-1"))
+	assert.True(t, registry.IsFlagged("node-a"))
+	assert.Empty(t, registry.FailedProofs("cid-1"))
+
+	assert.True(t, registry.PassedProof("node-a", "cid-2"))
+	assert.False(t, registry.IsFlagged("node-a"))
+}
@@ -0,0 +1,284 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gokul656/obscure-fs/internal/hashing"
+	"github.com/gokul656/obscure-fs/internal/networking"
+	"github.com/gokul656/obscure-fs/internal/storage"
+	"github.com/gokul656/obscure-fs/utils"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplicationPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		policy networking.ReplicationPolicy
+		want   int
+	}{
+		{networking.ReplicationPolicy{}, 1},
+		{networking.ReplicationPolicy{Factor: 1}, 1},
+		{networking.ReplicationPolicy{Factor: 3}, 2},
+		{networking.ReplicationPolicy{Factor: 4}, 3},
+		{networking.ReplicationPolicy{Factor: 3, Quorum: 1}, 1},
+		{networking.ReplicationPolicy{Factor: 3, Quorum: 5}, 3},
+	} {
+		assert.Equal(t, tc.want, tc.policy.RequiredCopies(), "%+v", tc.policy)
+	}
+}
+
+func TestHolders(t *testing.T) {
+	store := storage.NewFileStore()
+	store.StoreFile("cid", storage.FileEntry{Replicas: 3})
+
+	store.AddHolders("cid", "peer-1", "peer-2")
+	store.AddHolders("cid", "peer-2")
+	store.AddHolders("missing", "peer-1")
+	entry, _ := store.GetEntry("cid")
+	assert.Equal(t, []string{"peer-1", "peer-2"}, entry.Holders)
+
+	store.SetHolders("cid", []string{"peer-3"})
+	entry, _ = store.GetEntry("cid")
+	assert.Equal(t, []string{"peer-3"}, entry.Holders)
+}
+
+// contentCID writes content to a temp file and returns its CID.
+func contentCID(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "content")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	cid, err := hashing.HashFile(path)
+	assert.NoError(t, err)
+	return cid
+}
+
+type replicaReply struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+}
+
+// offerReplica pushes content as cid over the replica protocol the way a
+// replicating node does, and returns every reply of the receiver.
+func offerReplica(t *testing.T, from, to *networking.Network, cid, content string) []replicaReply {
+	stream, err := from.GetHost().NewStream(context.Background(), to.GetHost().ID(), utils.ReplicaProtocolID)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	defer stream.Close()
+	cleanupReplica(t, cid)
+
+	entry := storage.FileEntry{Visibility: storage.Private, Name: "replica", Size: int64(len(content))}
+	assert.NoError(t, json.NewEncoder(stream).Encode(map[string]any{"cid": cid, "entry": entry}))
+
+	var replies []replicaReply
+	decoder := json.NewDecoder(stream)
+	for {
+		var reply replicaReply
+		if err := decoder.Decode(&reply); err != nil {
+			return replies
+		}
+		replies = append(replies, reply)
+		if reply.Status == "send" {
+			_, err := stream.Write([]byte(content))
+			assert.NoError(t, err)
+		}
+	}
+}
+
+func TestReplicaProtocol(t *testing.T) {
+	a, _ := newTestNetwork(t)
+	b, store := newTestNetwork(t)
+	connect(t, a, b)
+
+	content := "replicated content"
+	cid := contentCID(t, content)
+
+	// content that does not hash to the offered CID is not stored
+	replies := offerReplica(t, a, b, cid, strings.ToUpper(content))
+	if assert.Len(t, replies, 2) {
+		assert.Equal(t, "send", replies[0].Status)
+		assert.Equal(t, "rejected", replies[1].Status)
+		assert.Contains(t, replies[1].Error, "does not match")
+	}
+	_, err := store.GetEntry(cid)
+	assert.Error(t, err)
+
+	// the quota is checked before any content is sent
+	store.SetQuota(storage.Quota{Node: int64(len(content)) - 1})
+	replies = offerReplica(t, a, b, cid, content)
+	if assert.Len(t, replies, 1) {
+		assert.Equal(t, "rejected", replies[0].Status)
+		assert.Contains(t, replies[0].Error, "quota exceeded")
+	}
+	store.SetQuota(storage.Quota{})
+
+	replies = offerReplica(t, a, b, cid, content)
+	if assert.Len(t, replies, 2) {
+		assert.Equal(t, "stored", replies[1].Status)
+	}
+	entry, err := store.GetEntry(cid)
+	assert.NoError(t, err)
+	assert.True(t, entry.Pinned)
+	assert.Equal(t, []string{a.GetHost().ID().String()}, entry.Holders)
+
+	// a copy already held is not sent again
+	replies = offerReplica(t, a, b, cid, content)
+	if assert.Len(t, replies, 1) {
+		assert.Equal(t, "have", replies[0].Status)
+	}
+}
+
+func TestReplicatePrivate(t *testing.T) {
+	content := "private content"
+	cid := contentCID(t, content)
+	policy := networking.ReplicationPolicy{Factor: 2}
+
+	a, storeA := newTestNetwork(t)
+	b, storeB := newTestNetwork(t)
+	connect(t, a, b)
+	storeContent(t, storeA, cid, content, storage.FileEntry{Visibility: storage.Private})
+	// peers are only candidates once identify told which protocols they run
+	assert.Eventually(t, func() bool {
+		return len(a.Placement(cid).Candidates) == 1
+	}, 5*time.Second, 100*time.Millisecond)
+
+	// private files stay on the uploading node by default
+	result, err := a.Replicate(context.Background(), cid, policy)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Stored)
+	_, err = storeB.GetEntry(cid)
+	assert.Error(t, err)
+
+	// a fresh peer, b would lead c to a on the DHT
+	c, storeC := newTestNetwork(t, networking.WithPrivateReplication())
+	d, storeD := newTestNetwork(t)
+	connect(t, c, d)
+	storeContent(t, storeC, cid, content, storage.FileEntry{Visibility: storage.Private})
+	cleanupReplica(t, cid)
+
+	assert.Eventually(t, func() bool {
+		return len(c.Placement(cid).Candidates) == 1
+	}, 5*time.Second, 100*time.Millisecond)
+	result, err = c.Replicate(context.Background(), cid, policy)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.Stored)
+	_, err = storeD.GetEntry(cid)
+	assert.NoError(t, err)
+}
+
+func TestShareHolders(t *testing.T) {
+	content := "shared content"
+	cid := contentCID(t, content)
+	cleanupReplica(t, cid)
+
+	a, storeA := newTestNetwork(t, networking.WithPrivateReplication())
+	b, storeB := newTestNetwork(t)
+	c, storeC := newTestNetwork(t)
+	connect(t, a, b)
+	connect(t, a, c)
+	storeContent(t, storeA, cid, content, storage.FileEntry{Visibility: storage.Private, Replicas: 3})
+	assert.Eventually(t, func() bool {
+		return len(a.Placement(cid).Candidates) == 2
+	}, 5*time.Second, 100*time.Millisecond)
+
+	result, err := a.Replicate(context.Background(), cid, networking.ReplicationPolicy{Factor: 3, Quorum: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.Stored)
+
+	// each holder learns of the others, not only of the uploader
+	holders := func(store *storage.FileStore) []string {
+		entry, _ := store.GetEntry(cid)
+		return entry.Holders
+	}
+	idA, idB, idC := a.GetHost().ID().String(), b.GetHost().ID().String(), c.GetHost().ID().String()
+	assert.Eventually(t, func() bool {
+		return len(holders(storeB)) == 2 && len(holders(storeC)) == 2
+	}, 5*time.Second, 100*time.Millisecond)
+	assert.ElementsMatch(t, []string{idA, idC}, holders(storeB))
+	assert.ElementsMatch(t, []string{idA, idB}, holders(storeC))
+
+	// peers that hold no copy cannot rewrite the holders
+	d, _ := newTestNetwork(t)
+	connect(t, d, b)
+	offer, _ := json.Marshal(map[string]any{"cid": cid, "holders": []string{d.GetHost().ID().String()}})
+	reply := request(t, d, b, utils.ReplicaProtocolID, string(offer)+"\n")
+	assert.Contains(t, string(reply), "rejected")
+	assert.ElementsMatch(t, []string{idA, idC}, holders(storeB))
+}
+
+// paddedReceiver makes n take replica pushes without storing them, and
+// reports the size each push was offered at and the bytes it carried.
+func paddedReceiver(n *networking.Network) <-chan []int64 {
+	pushes := make(chan []int64, 4)
+	n.GetHost().SetStreamHandler(utils.ReplicaProtocolID, func(stream network.Stream) {
+		defer stream.Close()
+		decoder := json.NewDecoder(stream)
+		var offer struct {
+			Entry   storage.FileEntry `json:"entry"`
+			Holders []string          `json:"holders"`
+		}
+		if decoder.Decode(&offer) != nil {
+			return
+		}
+		encoder := json.NewEncoder(stream)
+		if offer.Holders != nil {
+			encoder.Encode(map[string]string{"status": "updated"})
+			return
+		}
+
+		encoder.Encode(map[string]string{"status": "send"})
+		received, _ := io.CopyN(io.Discard, io.MultiReader(decoder.Buffered(), stream), offer.Entry.Size)
+		encoder.Encode(map[string]string{"status": "stored"})
+		pushes <- []int64{offer.Entry.Size, received}
+	})
+	return pushes
+}
+
+func TestPaddedTransfers(t *testing.T) {
+	content := append([]byte(strings.Repeat("padded ", 100)), make([]byte, 10)...)
+	a, storeA := newTestNetwork(t, networking.WithPrivateReplication())
+	path := filepath.Join(t.TempDir(), "content")
+	assert.NoError(t, os.WriteFile(path, content, 0644))
+	cid, err := a.ShareFile(context.Background(), path, storage.FileEntry{Visibility: storage.Private, Codec: storage.CodecInfo{Padding: "pow2"}}, 0)
+	assert.NoError(t, err)
+	entry, _ := storeA.GetEntry(cid)
+	// the shards of both nodes share a directory
+	defer os.RemoveAll(filepath.Dir(entry.Blobs[0]))
+	cleanupReplica(t, cid)
+
+	b, storeB := newTestNetwork(t)
+	c, _ := newTestNetwork(t)
+	pushes := paddedReceiver(c)
+	connect(t, a, b)
+	connect(t, a, c)
+	assert.NoError(t, a.AuthorizePeer(b.GetHost().ID().String()))
+
+	// a retrieval only carries the padded size
+	reply := request(t, b, a, utils.ProtocolID, cid+"\n")
+	assert.Len(t, reply, 1024)
+	assert.Equal(t, content, reply[:len(content)])
+	assert.Equal(t, make([]byte, 1024-len(content)), reply[len(content):])
+
+	// so does a replica push, the receiver stores the content itself
+	assert.Eventually(t, func() bool {
+		return len(a.Placement(cid).Candidates) == 2
+	}, 5*time.Second, 100*time.Millisecond)
+	result, err := a.Replicate(context.Background(), cid, networking.ReplicationPolicy{Factor: 3, Quorum: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.Stored)
+	assert.Equal(t, []int64{1024, 1024}, <-pushes)
+
+	entry, err = storeB.GetEntry(cid)
+	if assert.NoError(t, err) {
+		stored, err := os.ReadFile(entry.Path)
+		assert.NoError(t, err)
+		assert.Equal(t, content, stored)
+		assert.Equal(t, int64(1024), entry.Codec.PaddedSize)
+	}
+}
@@ -0,0 +1,46 @@
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gokul656/obscure-fs/internal/storage"
+	"github.com/gokul656/obscure-fs/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatProtocol(t *testing.T) {
+	a, store := newTestNetwork(t)
+	b, _ := newTestNetwork(t)
+	connect(t, b, a)
+
+	storeContent(t, store, "plain", "hello", storage.FileEntry{
+		Visibility: storage.Public,
+		Name:       "hello.txt",
+		Uploader:   "key:secret",
+		Pinned:     true,
+		Replicas:   3,
+		Holders:    []string{"holder"},
+	})
+	storeContent(t, store, "padded", "hello", storage.FileEntry{
+		Visibility: storage.Public,
+		Codec:      storage.CodecInfo{Name: "erasure", Padding: "pow2", PaddedSize: 8},
+	})
+
+	// only the public descriptive fields leave the node
+	var fields map[string]any
+	assert.NoError(t, json.Unmarshal(request(t, b, a, utils.ProtocolID, "stat plain"), &fields))
+	for _, private := range []string{"uploader", "pinned", "replicas", "holders", "codec"} {
+		assert.NotContains(t, fields, private)
+	}
+
+	var stat storage.FileStat
+	assert.NoError(t, json.Unmarshal(request(t, b, a, utils.ProtocolID, "stat plain"), &stat))
+	assert.Equal(t, "hello.txt", stat.Name)
+	assert.Equal(t, int64(5), stat.Size)
+	assert.Equal(t, "", stat.Padding)
+
+	assert.NoError(t, json.Unmarshal(request(t, b, a, utils.ProtocolID, "stat padded"), &stat))
+	assert.Equal(t, int64(8), stat.Size)
+	assert.Equal(t, "pow2", stat.Padding)
+}
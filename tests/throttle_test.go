@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/gokul656/obscure-fs/internal/throttle"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackgroundWindows(t *testing.T) {
+	windows, err := throttle.ParseWindows("22:00-06:00, 12:00-13:30")
+	assert.NoError(t, err)
+	assert.Len(t, windows, 2)
+	assert.Equal(t, "22:00-06:00", windows[0].String())
+
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 1, 1, hour, minute, 0, 0, time.Local)
+	}
+	throttler := throttle.New(throttle.Limits{}, windows)
+	assert.True(t, throttler.InWindow(at(23, 0)))
+	assert.True(t, throttler.InWindow(at(5, 59)))
+	assert.True(t, throttler.InWindow(at(13, 0)))
+	assert.False(t, throttler.InWindow(at(13, 30)))
+	assert.False(t, throttler.InWindow(at(9, 0)))
+
+	assert.True(t, throttle.New(throttle.Limits{}, nil).InWindow(at(9, 0)))
+
+	_, err = throttle.ParseWindows("22:00")
+	assert.Error(t, err)
+	_, err = throttle.ParseWindows("25:00-01:00")
+	assert.Error(t, err)
+}
+
+func TestThrottleRate(t *testing.T) {
+	throttler := throttle.New(throttle.Limits{Upload: 1 << 20, PeerDownload: 1 << 20}, nil)
+	data := make([]byte, 512<<10)
+
+	started := time.Now()
+	var out bytes.Buffer
+	_, err := throttler.Writer(context.Background(), &out, "peer", throttle.Interactive).Write(data)
+	assert.NoError(t, err)
+	assert.Equal(t, len(data), out.Len())
+	// the first chunk is free, the rest goes at 1MB/s
+	assert.Greater(t, time.Since(started), 400*time.Millisecond)
+
+	started = time.Now()
+	read, err := io.ReadAll(throttler.Reader(context.Background(), bytes.NewReader(data), "peer", throttle.Background))
+	assert.NoError(t, err)
+	assert.Len(t, read, len(data))
+	assert.Greater(t, time.Since(started), 400*time.Millisecond)
+
+	// the per-peer limit applies to each peer on its own
+	started = time.Now()
+	done := make(chan struct{})
+	for _, peer := range []string{"a", "b"} {
+		go func() {
+			io.ReadAll(throttler.Reader(context.Background(), bytes.NewReader(data), peer, throttle.Interactive))
+			done <- struct{}{}
+		}()
+	}
+	<-done
+	<-done
+	assert.Less(t, time.Since(started), 800*time.Millisecond)
+
+	// a nil throttler does not limit anything
+	var none *throttle.Throttler
+	assert.Equal(t, io.Writer(&out), none.Writer(context.Background(), &out, "peer", throttle.Interactive))
+}
+
+func TestThrottlePriority(t *testing.T) {
+	throttler := throttle.New(throttle.Limits{Upload: 1 << 20}, nil)
+	data := make([]byte, 256<<10)
+
+	done := make(chan throttle.Class, 2)
+	for _, class := range []throttle.Class{throttle.Background, throttle.Interactive} {
+		go func() {
+			throttler.Writer(context.Background(), io.Discard, "peer", class).Write(data)
+			done <- class
+		}()
+	}
+
+	// background traffic steps aside while interactive traffic waits
+	assert.Equal(t, throttle.Interactive, <-done)
+	assert.Equal(t, throttle.Background, <-done)
+}
+
+func TestThrottleCancel(t *testing.T) {
+	throttler := throttle.New(throttle.Limits{Upload: 1024}, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := throttler.Writer(ctx, io.Discard, "peer", throttle.Interactive).Write(make([]byte, 128<<10))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/gokul656/obscure-fs/internal/networking"
+	"github.com/gokul656/obscure-fs/internal/search"
+	"github.com/gokul656/obscure-fs/utils"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/stretchr/testify/assert"
+)
+
+// stalls holds every request a node gets open without answering it, and
+// reports the streams opened and the ones the requester reset.
+type stalls struct {
+	opened chan struct{}
+	resets chan struct{}
+}
+
+// stalledProvider starts a node that stalls and lists it on from as the
+// provider of cid.
+func stalledProvider(t *testing.T, from *networking.Network, cid string) (*networking.Network, stalls) {
+	provider, _ := newTestNetwork(t)
+	s := stalls{opened: make(chan struct{}, 16), resets: make(chan struct{}, 16)}
+	provider.GetHost().SetStreamHandler(utils.ProtocolID, func(stream network.Stream) {
+		defer stream.Close()
+		s.opened <- struct{}{}
+		if _, err := io.Copy(io.Discard, stream); err != nil {
+			s.resets <- struct{}{}
+		}
+	})
+	connect(t, from, provider)
+	from.Catalog().Add(search.Document{CID: cid}, provider.GetHost().ID().String())
+	return provider, s
+}
+
+func peerHealth(n, of *networking.Network) networking.PeerHealth {
+	for _, h := range n.Health().Peers() {
+		if h.Peer == of.GetHost().ID().String() {
+			return h
+		}
+	}
+	return networking.PeerHealth{}
+}
+
+// received reports whether c got a value.
+func received(c <-chan struct{}) func() bool {
+	return func() bool {
+		select {
+		case <-c:
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	policy := networking.DefaultHealthPolicy
+	policy.Retries = 0
+	a, _ := newTestNetwork(t, networking.WithTimeouts(networking.Timeouts{Request: 200 * time.Millisecond}), networking.WithHealthPolicy(policy))
+	provider, stalled := stalledProvider(t, a, "stalled")
+
+	started := time.Now()
+	_, err := a.StatFile(context.Background(), "stalled", "")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.GreaterOrEqual(t, time.Since(started), 200*time.Millisecond)
+	assert.Less(t, time.Since(started), 2*time.Second)
+
+	// the stream is reset rather than left to the provider, and the
+	// timeout is held against the peer
+	assert.Eventually(t, received(stalled.resets), 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, peerHealth(a, provider).Failures)
+}
+
+func TestListPeerFilesTimeout(t *testing.T) {
+	a, _ := newTestNetwork(t, networking.WithTimeouts(networking.Timeouts{Request: 200 * time.Millisecond}))
+	provider, stalled := stalledProvider(t, a, "stalled")
+
+	started := time.Now()
+	_, err := a.ListPeerFiles(context.Background(), provider.GetHost().ID())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(started), 2*time.Second)
+	assert.Eventually(t, received(stalled.resets), 2*time.Second, 10*time.Millisecond)
+}
+
+func TestRequestWithoutTimeout(t *testing.T) {
+	policy := networking.DefaultHealthPolicy
+	policy.Retries = 0
+	a, _ := newTestNetwork(t, networking.WithTimeouts(networking.Timeouts{}), networking.WithHealthPolicy(policy))
+	_, stalled := stalledProvider(t, a, "stalled")
+
+	// with no request timeout only the caller's context bounds the request
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	_, err := a.StatFile(ctx, "stalled", "")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.GreaterOrEqual(t, time.Since(started), 500*time.Millisecond)
+	assert.Eventually(t, received(stalled.resets), 2*time.Second, 10*time.Millisecond)
+}
+
+func TestRequestCancel(t *testing.T) {
+	a, _ := newTestNetwork(t)
+	provider, stalled := stalledProvider(t, a, "stalled")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	started := time.Now()
+	_, err := a.StatFile(ctx, "stalled", "")
+
+	// the caller gave up: no retry backoff is waited out and the peer is
+	// not blamed for it
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(started), networking.DefaultHealthPolicy.BaseBackoff)
+	assert.Eventually(t, received(stalled.resets), 2*time.Second, 10*time.Millisecond)
+	health := peerHealth(a, provider)
+	assert.Zero(t, health.Failures)
+	assert.Zero(t, health.ConsecutiveFailures)
+	assert.Equal(t, networking.CircuitClosed, health.Circuit)
+}
@@ -0,0 +1,135 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gokul656/obscure-fs/internal/search"
+	"github.com/gokul656/obscure-fs/internal/storage"
+	"github.com/gokul656/obscure-fs/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListPublicFiles(t *testing.T) {
+	store := storage.NewFileStore()
+	store.StoreFile("public", storage.FileEntry{Name: "report", Visibility: storage.Public})
+	store.StoreFile("unlisted", storage.FileEntry{Name: "report", Visibility: storage.Unlisted})
+	store.StoreFile("private", storage.FileEntry{Name: "report", Visibility: storage.Private})
+
+	files := store.ListPublicFiles()
+	if assert.Len(t, files, 1) {
+		assert.Equal(t, "public", files[0].CID)
+	}
+
+	// the local index serves the node's own API, it covers every visibility
+	assert.Len(t, store.Search(search.Query{Text: "report"}), 3)
+}
+
+func TestListFilesProtocol(t *testing.T) {
+	a, storeA := newTestNetwork(t)
+	b, _ := newTestNetwork(t)
+	storeContent(t, storeA, "public", "a", storage.FileEntry{Visibility: storage.Public})
+	storeContent(t, storeA, "unlisted", "b", storage.FileEntry{Visibility: storage.Unlisted})
+	storeContent(t, storeA, "private", "c", storage.FileEntry{Visibility: storage.Private})
+	connect(t, b, a)
+
+	files, err := b.ListPeerFiles(context.Background(), a.GetHost().ID())
+	assert.NoError(t, err)
+	if assert.Len(t, files, 1) {
+		assert.Equal(t, "public", files[0].CID)
+	}
+}
+
+func TestCanServe(t *testing.T) {
+	a, storeA := newTestNetwork(t)
+	b, _ := newTestNetwork(t)
+	storeContent(t, storeA, "unlisted", "unlisted content", storage.FileEntry{Visibility: storage.Unlisted})
+	storeContent(t, storeA, "private", "private content", storage.FileEntry{Visibility: storage.Private})
+	connect(t, b, a)
+
+	assert.Equal(t, "unlisted content", string(request(t, b, a, utils.ProtocolID, "unlisted")))
+	assert.Empty(t, request(t, b, a, utils.ProtocolID, "private"))
+	assert.Empty(t, request(t, b, a, utils.ProtocolID, "private not-a-token"))
+
+	// a token for another file or another peer does not open it
+	other, err := a.IssueToken([]string{"unlisted"}, time.Hour, "")
+	assert.NoError(t, err)
+	assert.Empty(t, request(t, b, a, utils.ProtocolID, fmt.Sprintf("private %s", other)))
+	elsewhere, err := a.IssueToken([]string{"private"}, time.Hour, a.GetHost().ID().String())
+	assert.NoError(t, err)
+	assert.Empty(t, request(t, b, a, utils.ProtocolID, fmt.Sprintf("private %s", elsewhere)))
+
+	token, err := a.IssueToken([]string{"private"}, time.Hour, b.GetHost().ID().String())
+	assert.NoError(t, err)
+	assert.Equal(t, "private content", string(request(t, b, a, utils.ProtocolID, fmt.Sprintf("private %s", token))))
+
+	assert.NoError(t, a.AuthorizePeer(b.GetHost().ID().String()))
+	assert.Equal(t, "private content", string(request(t, b, a, utils.ProtocolID, "private")))
+}
+
+func TestCatalogVisibility(t *testing.T) {
+	ctx := context.Background()
+	a, storeA := newTestNetwork(t)
+	b, storeB := newTestNetwork(t)
+	assert.NoError(t, a.StartFileAnnouncements(ctx))
+	assert.NoError(t, b.StartFileAnnouncements(ctx))
+	storeContent(t, storeA, "public", "a", storage.FileEntry{Name: "report", Visibility: storage.Public})
+	storeContent(t, storeA, "unlisted", "b", storage.FileEntry{Name: "report", Visibility: storage.Unlisted})
+	storeContent(t, storeB, "other", "c", storage.FileEntry{Visibility: storage.Public})
+	connect(t, b, a)
+
+	// the catalogs are seeded with the public files only, once both are
+	// seeded the nodes see each other on the topic
+	assert.Eventually(t, func() bool {
+		_, seededA := a.Catalog().Get("other")
+		_, seededB := b.Catalog().Get("public")
+		return seededA && seededB
+	}, 10*time.Second, 50*time.Millisecond)
+	_, ok := b.Catalog().Get("unlisted")
+	assert.False(t, ok)
+
+	// announcements published before the gossip streams are up are lost,
+	// the change is made again until one arrives
+	assert.Eventually(t, func() bool {
+		a.SetVisibility(ctx, "unlisted", storage.Unlisted)
+		assert.NoError(t, a.SetVisibility(ctx, "unlisted", storage.Public))
+		time.Sleep(100 * time.Millisecond)
+		_, ok := b.Catalog().Get("unlisted")
+		return ok
+	}, 10*time.Second, 100*time.Millisecond)
+
+	assert.NoError(t, a.SetVisibility(ctx, "public", storage.Private))
+	assert.Eventually(t, func() bool {
+		_, ok := b.Catalog().Get("public")
+		return !ok
+	}, 10*time.Second, 50*time.Millisecond)
+	assert.Len(t, b.Catalog().Search(search.Query{Text: "report"}), 1)
+}
+
+func TestCommandFraming(t *testing.T) {
+	a, storeA := newTestNetwork(t)
+	b, _ := newTestNetwork(t)
+	storeContent(t, storeA, "private", "private content", storage.FileEntry{Visibility: storage.Private})
+	connect(t, b, a)
+	token, err := a.IssueToken([]string{"private"}, time.Hour, b.GetHost().ID().String())
+	assert.NoError(t, err)
+
+	// a request split across writes is read up to its newline
+	stream, err := b.GetHost().NewStream(context.Background(), a.GetHost().ID(), utils.ProtocolID)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer stream.Close()
+	half := len(token) / 2
+	stream.Write([]byte("private " + token[:half]))
+	time.Sleep(50 * time.Millisecond)
+	stream.Write([]byte(token[half:] + "\n"))
+	reply, _ := io.ReadAll(stream)
+	assert.Equal(t, "private content", string(reply))
+
+	assert.Empty(t, request(t, b, a, utils.ProtocolID, strings.Repeat("x", 8192)))
+}
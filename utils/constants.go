@@ -3,3 +3,30 @@ package utils
 import "github.com/libp2p/go-libp2p/core/protocol"
 
 const ProtocolID = protocol.ID("oscure-fs/1.0.0")
+
+// DHTProtocolPrefix replaces /ipfs on the DHT protocols of a private swarm.
+const DHTProtocolPrefix = protocol.ID("/obscure-fs")
+
+// RepoPath is the default directory for persisted node state.
+const RepoPath = "./repo"
+
+// NodesTopic carries signed node announcements.
+const NodesTopic = "obscure-fs/nodes/1.0.0"
+
+// FilesTopic carries add and remove events for public files.
+const FilesTopic = "obscure-fs/files/1.0.0"
+
+// TempPath holds copies of content retrieved from other nodes.
+const TempPath = "./temp"
+
+// ReplicaProtocolID pushes copies of a file to other nodes.
+const ReplicaProtocolID = protocol.ID("/obscure-fs/replica/1.0.0")
+
+// ProofProtocolID challenges peers to prove they still hold a file.
+const ProofProtocolID = protocol.ID("/obscure-fs/proof/1.0.0")
+
+// ReplicaPath holds copies of files pushed by other nodes.
+const ReplicaPath = "./replicas"
+
+// PinsTopic carries the state of the cluster pin set.
+const PinsTopic = "obscure-fs/pins/1.0.0"
@@ -1,8 +1,13 @@
 package utils
 
 import (
+	"encoding/json"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 )
 
 func CopyFile(sourcePath, destPath string) error {
@@ -31,3 +36,72 @@ func CopyFile(sourcePath, destPath string) error {
 
 	return nil
 }
+
+// WriteJSONFile replaces path with the JSON encoding of v. The data goes to
+// a temp file first so a crash never leaves a truncated file behind.
+func WriteJSONFile(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ReadJSONFile decodes path into v, a missing file leaves v untouched.
+func ReadJSONFile(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+var sizeUnits = map[string]int64{
+	"":    1,
+	"B":   1,
+	"K":   1 << 10,
+	"KB":  1 << 10,
+	"KIB": 1 << 10,
+	"M":   1 << 20,
+	"MB":  1 << 20,
+	"MIB": 1 << 20,
+	"G":   1 << 30,
+	"GB":  1 << 30,
+	"GIB": 1 << 30,
+	"T":   1 << 40,
+	"TB":  1 << 40,
+	"TIB": 1 << 40,
+}
+
+// ParseSize reads a byte size such as "512", "64KB" or "10GB". Units are
+// powers of 1024.
+func ParseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" {
+		return 0, nil
+	}
+
+	i := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	if i < 0 {
+		i = len(s)
+	}
+
+	value, err := strconv.ParseInt(s[:i], 10, 64)
+	unit, ok := sizeUnits[strings.TrimSpace(s[i:])]
+	if err != nil || !ok || value < 0 {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+	return value * unit, nil
+}